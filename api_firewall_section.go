@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+	"strconv"
+)
+
+// FirewallSection is the subset of a distributed firewall <section> needed
+// to tell universal sections apart, which gonsx does not model.
+type FirewallSection struct {
+	XMLName   xml.Name `xml:"section"`
+	ID        string   `xml:"id,attr,omitempty"`
+	Name      string   `xml:"name,attr"`
+	ManagedBy string   `xml:"managedBy,attr,omitempty"`
+	Type      string   `xml:"type,attr,omitempty"`
+}
+
+// GetFirewallSectionAPI api object
+type GetFirewallSectionAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetFirewallSection returns a new object of GetFirewallSectionAPI.
+func NewGetFirewallSection(sectionID int) *GetFirewallSectionAPI {
+	this := new(GetFirewallSectionAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/4.0/firewall/globalroot-0/config/layer3sections/"+strconv.Itoa(sectionID), nil, new(FirewallSection))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetFirewallSectionAPI.
+func (ga GetFirewallSectionAPI) GetResponse() *FirewallSection {
+	return ga.ResponseObject().(*FirewallSection)
+}
+
+// FirewallConfiguration is the subset of the distributed firewall
+// configuration needed to tell universal sections apart.
+type FirewallConfiguration struct {
+	XMLName        xml.Name          `xml:"firewallConfiguration"`
+	Layer3Sections []FirewallSection `xml:"layer3Sections>section"`
+}
+
+// Layer3Section returns the layer 3 section with the given ID, or nil.
+func (c FirewallConfiguration) Layer3Section(sectionID int) *FirewallSection {
+	for i := range c.Layer3Sections {
+		if c.Layer3Sections[i].ID == strconv.Itoa(sectionID) {
+			return &c.Layer3Sections[i]
+		}
+	}
+	return nil
+}
+
+// GetFirewallConfigAPI api object
+type GetFirewallConfigAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetFirewallConfig returns a new object of GetFirewallConfigAPI.
+func NewGetFirewallConfig() *GetFirewallConfigAPI {
+	this := new(GetFirewallConfigAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/4.0/firewall/globalroot-0/config", nil, new(FirewallConfiguration))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetFirewallConfigAPI.
+func (ga GetFirewallConfigAPI) GetResponse() *FirewallConfiguration {
+	return ga.ResponseObject().(*FirewallConfiguration)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+)
+
+// GroupingObjects is the <list> returned by the grouping object listings
+// (ipset, macset, securitygroup, application, applicationgroup). Only the
+// object IDs are of interest here.
+type GroupingObjects struct {
+	Objects []GroupingObject `xml:",any"`
+}
+
+// GroupingObject is a single element of GroupingObjects.
+type GroupingObject struct {
+	ObjectID    string `xml:"objectId"`
+	Name        string `xml:"name"`
+	IsUniversal bool   `xml:"isUniversal"`
+}
+
+// GetAllGroupingObjectsAPI api object
+type GetAllGroupingObjectsAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetAllGroupingObjects returns a new object of GetAllGroupingObjectsAPI
+// listing all objects of objectType (e.g. ipset or macset) within scopeID.
+func NewGetAllGroupingObjects(objectType, scopeID string) *GetAllGroupingObjectsAPI {
+	this := new(GetAllGroupingObjectsAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/"+objectType+"/scope/"+scopeID, nil, new(GroupingObjects))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetAllGroupingObjectsAPI.
+func (ga GetAllGroupingObjectsAPI) GetResponse() *GroupingObjects {
+	return ga.ResponseObject().(*GroupingObjects)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/gregsteel/gonsx/api/ipset"
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+)
+
+// IPSet mirrors ipset.IPSet, always sending the description and
+// inheritanceAllowed, which gonsx leaves out when they are empty or false
+// so that they could never be cleared.
+type IPSet struct {
+	XMLName            xml.Name `xml:"ipset"`
+	ObjectID           string   `xml:"objectId,omitempty"`
+	Revision           int      `xml:"revision,omitempty"`
+	Name               string   `xml:"name,omitempty"`
+	Description        string   `xml:"description"`
+	InheritanceAllowed bool     `xml:"inheritanceAllowed"`
+	Value              string   `xml:"value,omitempty"`
+}
+
+// newIPSet returns the IPSet to send for the ipset read from NSX.
+func newIPSet(ipsetObject *ipset.IPSet) *IPSet {
+	return &IPSet{
+		ObjectID:           ipsetObject.ObjectID,
+		Revision:           ipsetObject.Revision,
+		Name:               ipsetObject.Name,
+		Description:        ipsetObject.Description,
+		InheritanceAllowed: ipsetObject.InheritanceAllowed,
+		Value:              ipsetObject.Value,
+	}
+}
+
+// UpdateIPSetAPI api object
+type UpdateIPSetAPI struct {
+	*api.BaseAPI
+}
+
+// NewUpdateIPSet returns a new object of UpdateIPSetAPI.
+func NewUpdateIPSet(ipsetID string, ipsetPayload *IPSet) *UpdateIPSetAPI {
+	this := new(UpdateIPSetAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPut, "/api/2.0/services/ipset/"+ipsetID, ipsetPayload, new(IPSet))
+	return this
+}
+
+// GetResponse returns the ResponseObject of UpdateIPSetAPI.
+func (ua UpdateIPSetAPI) GetResponse() *IPSet {
+	return ua.ResponseObject().(*IPSet)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/sky-uk/gonsx/api"
+	"github.com/sky-uk/gonsx/api/securitygroup"
+	"net/http"
+)
+
+// SecurityGroup mirrors securitygroup.SecurityGroup, adding the static
+// include/exclude membership which gonsx does not model.
+type SecurityGroup struct {
+	XMLName                 xml.Name                               `xml:"securitygroup"`
+	ObjectID                string                                 `xml:"objectId,omitempty"`
+	ObjectTypeName          string                                 `xml:"objectTypeName,omitempty"`
+	Revision                int                                    `xml:"revision,omitempty"`
+	Type                    string                                 `xml:"type,omitempty>typeName,omitempty"`
+	Name                    string                                 `xml:"name"`
+	Description             string                                 `xml:"description,omitempty"`
+	IsUniversal             bool                                   `xml:"isUniversal,omitempty"`
+	Scope                   *SecurityGroupScope                    `xml:"scope,omitempty"`
+	InheritanceAllowed      bool                                   `xml:"inheritanceAllowed,omitempty"`
+	Members                 []SecurityGroupMember                  `xml:"member,omitempty"`
+	ExcludeMembers          []SecurityGroupMember                  `xml:"excludeMember,omitempty"`
+	DynamicMemberDefinition *securitygroup.DynamicMemberDefinition `xml:"dynamicMemberDefinition,omitempty"`
+}
+
+// SecurityGroupScope - <scope> element of <securitygroup>
+type SecurityGroupScope struct {
+	ID             string `xml:"id"`
+	ObjectTypeName string `xml:"objectTypeName,omitempty"`
+	Name           string `xml:"name,omitempty"`
+}
+
+// SecurityGroupMember - <member> and <excludeMember> elements of <securitygroup>
+type SecurityGroupMember struct {
+	ObjectID       string `xml:"objectId"`
+	ObjectTypeName string `xml:"objectTypeName,omitempty"`
+	Name           string `xml:"name,omitempty"`
+}
+
+// CreateSecurityGroupAPI api object
+type CreateSecurityGroupAPI struct {
+	*api.BaseAPI
+}
+
+// NewCreateSecurityGroup returns a new object of CreateSecurityGroupAPI.
+func NewCreateSecurityGroup(scopeID string, securityGroup *SecurityGroup) *CreateSecurityGroupAPI {
+	this := new(CreateSecurityGroupAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPost, "/api/2.0/services/securitygroup/bulk/"+scopeID, securityGroup, new(string))
+	return this
+}
+
+// GetResponse returns the ID of the created security group.
+func (ca CreateSecurityGroupAPI) GetResponse() string {
+	return ca.ResponseObject().(string)
+}
+
+// GetSecurityGroupAPI api object
+type GetSecurityGroupAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetSecurityGroup returns a new object of GetSecurityGroupAPI.
+func NewGetSecurityGroup(securityGroupID string) *GetSecurityGroupAPI {
+	this := new(GetSecurityGroupAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/securitygroup/"+securityGroupID, nil, new(SecurityGroup))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetSecurityGroupAPI.
+func (ga GetSecurityGroupAPI) GetResponse() *SecurityGroup {
+	return ga.ResponseObject().(*SecurityGroup)
+}
+
+// UpdateSecurityGroupAPI api object
+type UpdateSecurityGroupAPI struct {
+	*api.BaseAPI
+}
+
+// NewUpdateSecurityGroup returns a new object of UpdateSecurityGroupAPI.
+func NewUpdateSecurityGroup(securityGroupID string, securityGroup *SecurityGroup) *UpdateSecurityGroupAPI {
+	this := new(UpdateSecurityGroupAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPut, "/api/2.0/services/securitygroup/bulk/"+securityGroupID, securityGroup, new(SecurityGroup))
+	return this
+}
+
+// GetResponse returns the ResponseObject of UpdateSecurityGroupAPI.
+func (ua UpdateSecurityGroupAPI) GetResponse() *SecurityGroup {
+	return ua.ResponseObject().(*SecurityGroup)
+}
+
+// SecurityGroupVMNodes - <vmnodes> response of the virtual machine translation API.
+type SecurityGroupVMNodes struct {
+	VMNodes []SecurityGroupVMNode `xml:"vmnode"`
+}
+
+// SecurityGroupVMNode - <vmnode> element of <vmnodes>
+type SecurityGroupVMNode struct {
+	VMID   string `xml:"vmId"`
+	VMName string `xml:"vmName"`
+}
+
+// SecurityGroupIPNodes - <ipNodes> response of the IP address translation API.
+type SecurityGroupIPNodes struct {
+	IPNodes []SecurityGroupIPNode `xml:"ipNode"`
+}
+
+// SecurityGroupIPNode - <ipNode> element of <ipNodes>
+type SecurityGroupIPNode struct {
+	IPAddresses []string `xml:"ipAddresses>string"`
+}
+
+// SecurityGroupMACNodes - <macNodes> response of the MAC address translation API.
+type SecurityGroupMACNodes struct {
+	MACNodes []SecurityGroupMACNode `xml:"macNode"`
+}
+
+// SecurityGroupMACNode - <macNode> element of <macNodes>
+type SecurityGroupMACNode struct {
+	MACAddresses []string `xml:"macAddresses>string"`
+}
+
+// SecurityGroupVnicNodes - <vnicNodes> response of the vNIC translation API.
+type SecurityGroupVnicNodes struct {
+	VnicNodes []SecurityGroupVnicNode `xml:"vnicNode"`
+}
+
+// SecurityGroupVnicNode - <vnicNode> element of <vnicNodes>
+type SecurityGroupVnicNode struct {
+	UUID string `xml:"uuid"`
+}
+
+// GetSecurityGroupTranslationAPI api object
+type GetSecurityGroupTranslationAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetSecurityGroupTranslation returns a new object of
+// GetSecurityGroupTranslationAPI. The translation is one of virtualmachines,
+// ipaddresses, macaddresses or vnics, and responseObject must be the matching
+// node list.
+func NewGetSecurityGroupTranslation(securityGroupID, translation string, responseObject interface{}) *GetSecurityGroupTranslationAPI {
+	this := new(GetSecurityGroupTranslationAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/securitygroup/"+securityGroupID+"/translation/"+translation, nil, responseObject)
+	return this
+}
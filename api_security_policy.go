@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/sky-uk/gonsx/api"
+	"github.com/sky-uk/gonsx/api/securitypolicy"
+	"net/http"
+)
+
+// Service Composer action categories.
+const (
+	securityPolicyCategoryFirewall        = "firewall"
+	securityPolicyCategoryEndpoint        = "endpoint"
+	securityPolicyCategoryTrafficSteering = "traffic_steering"
+)
+
+// securityPolicyActionClasses maps each action category to the class NSX
+// expects on its <action> elements.
+var securityPolicyActionClasses = map[string]string{
+	securityPolicyCategoryFirewall:        "firewallSecurityAction",
+	securityPolicyCategoryEndpoint:        "endpointSecurityAction",
+	securityPolicyCategoryTrafficSteering: "trafficSteeringSecurityAction",
+}
+
+// SecurityPolicies mirrors securitypolicy.SecurityPolicies using SecurityPolicy.
+type SecurityPolicies struct {
+	SecurityPolicies []SecurityPolicy `xml:"securityPolicy"`
+}
+
+// SecurityPolicy mirrors securitypolicy.SecurityPolicy. Unlike gonsx it keeps
+// every <actionsByCategory> element apart, so that guest and network
+// introspection actions survive a read-modify-write of the policy, and it
+// models policy inheritance.
+type SecurityPolicy struct {
+	XMLName              xml.Name                       `xml:"securityPolicy"`
+	ObjectID             string                         `xml:"objectId,omitempty"`
+	ObjectTypeName       string                         `xml:"objectTypeName,omitempty"`
+	VsmUUID              string                         `xml:"vsmUuid,omitempty"`
+	NodeID               string                         `xml:"nodeId,omitempty"`
+	Revision             int                            `xml:"revision,omitempty"`
+	TypeName             string                         `xml:"type,omitempty>typeName,omitempty"`
+	Name                 string                         `xml:"name,omitempty"`
+	Description          string                         `xml:"description,omitempty"`
+	Precedence           string                         `xml:"precedence"`
+	IsUniversal          bool                           `xml:"isUniversal,omitempty"`
+	InheritanceAllowed   bool                           `xml:"inheritanceAllowed,omitempty"`
+	Parent               *SecurityPolicyParent          `xml:"parent,omitempty"`
+	ActionsByCategory    []ActionsByCategory            `xml:"actionsByCategory,omitempty"`
+	SecurityGroupBinding []securitypolicy.SecurityGroup `xml:"securityGroupBinding,omitempty"`
+}
+
+// SecurityPolicyParent - <parent> element of <securityPolicy>
+type SecurityPolicyParent struct {
+	ObjectID string `xml:"objectId"`
+}
+
+// ActionsByCategory - <actionsByCategory> element of <securityPolicy>
+type ActionsByCategory struct {
+	Category string   `xml:"category"`
+	Actions  []Action `xml:"action,omitempty"`
+}
+
+// Action - <action> element of <actionsByCategory>. Which of the fields are
+// relevant depends on the category of the action.
+type Action struct {
+	Class                  string                         `xml:"class,attr"`
+	ObjectID               string                         `xml:"objectId,omitempty"`
+	ObjectTypeName         string                         `xml:"objectTypeName,omitempty"`
+	VsmUUID                string                         `xml:"vsmUuid,omitempty"`
+	NodeID                 string                         `xml:"nodeId,omitempty"`
+	Revision               int                            `xml:"revision,omitempty"`
+	TypeName               string                         `xml:"type,omitempty>typeName,omitempty"`
+	Name                   string                         `xml:"name,omitempty"`
+	Description            string                         `xml:"description,omitempty"`
+	Category               string                         `xml:"category"`
+	IsEnabled              bool                           `xml:"isEnabled"`
+	IsActionEnforced       bool                           `xml:"isActionEnforced,omitempty"`
+	Action                 string                         `xml:"action,omitempty"`
+	Direction              string                         `xml:"direction,omitempty"`
+	Logged                 bool                           `xml:"logged,omitempty"`
+	Redirect               *bool                          `xml:"redirect,omitempty"`
+	ServiceID              string                         `xml:"serviceId,omitempty"`
+	ServiceProfile         *ServiceProfile                `xml:"serviceProfile,omitempty"`
+	SecondarySecurityGroup []securitypolicy.SecurityGroup `xml:"secondarySecurityGroup,omitempty"`
+	Applications           *securitypolicy.Applications   `xml:"applications,omitempty"`
+}
+
+// ServiceProfile - <serviceProfile> element of <action>
+type ServiceProfile struct {
+	ObjectID string `xml:"objectId"`
+}
+
+func (sp SecurityPolicy) String() string {
+	return fmt.Sprintf("SecurityPolicy with objectId: %s", sp.ObjectID)
+}
+
+// AddSecurityGroupBinding adds the security group to the bindings if it is not there yet.
+func (sp *SecurityPolicy) AddSecurityGroupBinding(objectID string) {
+	for _, secGroup := range sp.SecurityGroupBinding {
+		if secGroup.ObjectID == objectID {
+			return
+		}
+	}
+	sp.SecurityGroupBinding = append(sp.SecurityGroupBinding, securitypolicy.SecurityGroup{ObjectID: objectID})
+}
+
+// RemoveSecurityGroupBinding removes the security group from the bindings.
+func (sp *SecurityPolicy) RemoveSecurityGroupBinding(objectID string) {
+	for idx, secGroup := range sp.SecurityGroupBinding {
+		if secGroup.ObjectID == objectID {
+			sp.SecurityGroupBinding = append(sp.SecurityGroupBinding[:idx], sp.SecurityGroupBinding[idx+1:]...)
+			return
+		}
+	}
+}
+
+// FilterByName returns the security policy with the given name, or an empty one.
+func (spList SecurityPolicies) FilterByName(name string) *SecurityPolicy {
+	var securityPolicyFound SecurityPolicy
+	for _, securityPolicy := range spList.SecurityPolicies {
+		if securityPolicy.Name == name {
+			securityPolicyFound = securityPolicy
+			break
+		}
+	}
+	return &securityPolicyFound
+}
+
+// GetActionByName returns the action with the given name in any category,
+// or an empty one.
+func (sp *SecurityPolicy) GetActionByName(name string) *Action {
+	for _, actionsByCategory := range sp.ActionsByCategory {
+		for idx := range actionsByCategory.Actions {
+			if actionsByCategory.Actions[idx].Name == name {
+				return &actionsByCategory.Actions[idx]
+			}
+		}
+	}
+	return &Action{}
+}
+
+// GetActionByUUID returns the action with the given VsmUUID in any category,
+// or an empty one.
+func (sp *SecurityPolicy) GetActionByUUID(uuid string) *Action {
+	for _, actionsByCategory := range sp.ActionsByCategory {
+		for idx := range actionsByCategory.Actions {
+			if actionsByCategory.Actions[idx].VsmUUID == uuid {
+				return &actionsByCategory.Actions[idx]
+			}
+		}
+	}
+	return &Action{}
+}
+
+// AddAction appends the action to the list of its category.
+func (sp *SecurityPolicy) AddAction(action Action) {
+	action.Class = securityPolicyActionClasses[action.Category]
+	for idx := range sp.ActionsByCategory {
+		if sp.ActionsByCategory[idx].Category == action.Category {
+			sp.ActionsByCategory[idx].Actions = append(sp.ActionsByCategory[idx].Actions, action)
+			return
+		}
+	}
+	sp.ActionsByCategory = append(sp.ActionsByCategory, ActionsByCategory{Category: action.Category, Actions: []Action{action}})
+}
+
+// RemoveActionByName removes the action with the given name from whichever
+// category it is in.
+func (sp *SecurityPolicy) RemoveActionByName(name string) {
+	for categoryIdx := range sp.ActionsByCategory {
+		actions := sp.ActionsByCategory[categoryIdx].Actions
+		for idx, action := range actions {
+			if action.Name == name {
+				sp.ActionsByCategory[categoryIdx].Actions = append(actions[:idx], actions[idx+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// RemoveActionByUUID removes the action with the given VsmUUID from whichever
+// category it is in.
+func (sp *SecurityPolicy) RemoveActionByUUID(uuid string) {
+	for categoryIdx := range sp.ActionsByCategory {
+		actions := sp.ActionsByCategory[categoryIdx].Actions
+		for idx, action := range actions {
+			if action.VsmUUID == uuid {
+				sp.ActionsByCategory[categoryIdx].Actions = append(actions[:idx], actions[idx+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// CreateSecurityPolicyAPI api object
+type CreateSecurityPolicyAPI struct {
+	*api.BaseAPI
+}
+
+// NewCreateSecurityPolicy returns a new object of CreateSecurityPolicyAPI.
+func NewCreateSecurityPolicy(securityPolicy *SecurityPolicy) *CreateSecurityPolicyAPI {
+	this := new(CreateSecurityPolicyAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPost, "/api/2.0/services/policy/securitypolicy", securityPolicy, new(string))
+	return this
+}
+
+// GetResponse returns the ID of the created security policy.
+func (ca CreateSecurityPolicyAPI) GetResponse() string {
+	return ca.ResponseObject().(string)
+}
+
+// GetAllSecurityPoliciesAPI api object
+type GetAllSecurityPoliciesAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetAllSecurityPolicies returns a new object of GetAllSecurityPoliciesAPI.
+func NewGetAllSecurityPolicies() *GetAllSecurityPoliciesAPI {
+	this := new(GetAllSecurityPoliciesAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/policy/securitypolicy/all", nil, new(SecurityPolicies))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetAllSecurityPoliciesAPI.
+func (ga GetAllSecurityPoliciesAPI) GetResponse() *SecurityPolicies {
+	return ga.ResponseObject().(*SecurityPolicies)
+}
+
+// UpdateSecurityPolicyAPI api object
+type UpdateSecurityPolicyAPI struct {
+	*api.BaseAPI
+}
+
+// NewUpdateSecurityPolicy returns a new object of UpdateSecurityPolicyAPI.
+func NewUpdateSecurityPolicy(securityPolicyID string, securityPolicy *SecurityPolicy) *UpdateSecurityPolicyAPI {
+	this := new(UpdateSecurityPolicyAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPut, "/api/2.0/services/policy/securitypolicy/"+securityPolicyID, securityPolicy, new(string))
+	return this
+}
+
+// GetSecurityPolicyAPI api object
+type GetSecurityPolicyAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetSecurityPolicy returns a new object of GetSecurityPolicyAPI.
+func NewGetSecurityPolicy(securityPolicyID string) *GetSecurityPolicyAPI {
+	this := new(GetSecurityPolicyAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/policy/securitypolicy/"+securityPolicyID, nil, new(SecurityPolicy))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetSecurityPolicyAPI.
+func (ga GetSecurityPolicyAPI) GetResponse() *SecurityPolicy {
+	return ga.ResponseObject().(*SecurityPolicy)
+}
+
+// SecurityPolicyBindingAPI api object
+type SecurityPolicyBindingAPI struct {
+	*api.BaseAPI
+}
+
+// NewApplySecurityPolicyBinding returns a new object of SecurityPolicyBindingAPI
+// which applies the security policy to the security group.
+func NewApplySecurityPolicyBinding(securityPolicyID, securityGroupID string) *SecurityPolicyBindingAPI {
+	this := new(SecurityPolicyBindingAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPost, "/api/2.0/services/policy/securitypolicy/"+securityPolicyID+"/sgbinding/"+securityGroupID, nil, new(string))
+	return this
+}
+
+// NewRemoveSecurityPolicyBinding returns a new object of SecurityPolicyBindingAPI
+// which unapplies the security policy from the security group.
+func NewRemoveSecurityPolicyBinding(securityPolicyID, securityGroupID string) *SecurityPolicyBindingAPI {
+	this := new(SecurityPolicyBindingAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodDelete, "/api/2.0/services/policy/securitypolicy/"+securityPolicyID+"/sgbinding/"+securityGroupID, nil, new(string))
+	return this
+}
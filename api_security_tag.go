@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+)
+
+// SecurityTags mirrors securitytag.SecurityTags using SecurityTag.
+type SecurityTags struct {
+	SecurityTags []SecurityTag `xml:"securityTag"`
+}
+
+// SecurityTag mirrors securitytag.SecurityTag, adding the universal flag
+// which gonsx does not model.
+type SecurityTag struct {
+	XMLName     xml.Name `xml:"securityTag"`
+	ObjectID    string   `xml:"objectId,omitempty"`
+	Name        string   `xml:"name"`
+	Description string   `xml:"description"`
+	TypeName    string   `xml:"type>typeName"`
+	Revision    int      `xml:"revision,omitempty"`
+	IsUniversal bool     `xml:"isUniversal"`
+}
+
+// FilterByName returns the security tag with the given name, or an empty one.
+func (s SecurityTags) FilterByName(name string) *SecurityTag {
+	var securityTagFound SecurityTag
+	for _, securityTag := range s.SecurityTags {
+		if securityTag.Name == name {
+			securityTagFound = securityTag
+			break
+		}
+	}
+	return &securityTagFound
+}
+
+// CreateSecurityTagAPI api object
+type CreateSecurityTagAPI struct {
+	*api.BaseAPI
+}
+
+// NewCreateSecurityTag returns a new object of CreateSecurityTagAPI.
+func NewCreateSecurityTag(securityTag *SecurityTag) *CreateSecurityTagAPI {
+	this := new(CreateSecurityTagAPI)
+	securityTag.TypeName = "SecurityTag"
+	this.BaseAPI = api.NewBaseAPI(http.MethodPost, "/api/2.0/services/securitytags/tag", securityTag, new(string))
+	return this
+}
+
+// GetResponse returns the ID of the created security tag.
+func (ca CreateSecurityTagAPI) GetResponse() string {
+	return ca.ResponseObject().(string)
+}
+
+// GetAllSecurityTagsAPI api object
+type GetAllSecurityTagsAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetAllSecurityTags returns a new object of GetAllSecurityTagsAPI. NSX
+// only lists universal security tags when asked for them explicitly.
+func NewGetAllSecurityTags(universal bool) *GetAllSecurityTagsAPI {
+	this := new(GetAllSecurityTagsAPI)
+	endpoint := "/api/2.0/services/securitytags/tag"
+	if universal {
+		endpoint += "?isUniversal=true"
+	}
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, endpoint, nil, new(SecurityTags))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetAllSecurityTagsAPI.
+func (ga GetAllSecurityTagsAPI) GetResponse() *SecurityTags {
+	return ga.ResponseObject().(*SecurityTags)
+}
+
+// UpdateSecurityTagAPI api object
+type UpdateSecurityTagAPI struct {
+	*api.BaseAPI
+}
+
+// NewUpdateSecurityTag returns a new object of UpdateSecurityTagAPI.
+func NewUpdateSecurityTag(securityTagID string, securityTag *SecurityTag) *UpdateSecurityTagAPI {
+	this := new(UpdateSecurityTagAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPut, "/api/2.0/services/securitytags/tag/"+securityTagID, securityTag, new(string))
+	return this
+}
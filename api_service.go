@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+)
+
+// ApplicationService mirrors service.ApplicationService, adding the source
+// port and ALG fields of the elements which gonsx does not model.
+type ApplicationService struct {
+	XMLName     xml.Name             `xml:"application"`
+	Name        string               `xml:"name"`
+	ObjectID    string               `xml:"objectId,omitempty"`
+	Type        string               `xml:"type,omitempty>typeName,omitempty"`
+	Revision    int                  `xml:"revision,omitempty"`
+	Description string               `xml:"description"`
+	IsUniversal bool                 `xml:"isUniversal,omitempty"`
+	Element     []ApplicationElement `xml:"element"`
+	Layer       string               `xml:"layer,omitempty"`
+}
+
+// ApplicationElement - <element> element of <application>
+type ApplicationElement struct {
+	ApplicationProtocol string `xml:"applicationProtocol"`
+	Value               string `xml:"value,omitempty"`
+	SourcePort          string `xml:"sourcePort,omitempty"`
+	AppGUIDName         string `xml:"appGuidName,omitempty"`
+}
+
+// CreateServiceAPI api object
+type CreateServiceAPI struct {
+	*api.BaseAPI
+}
+
+// NewCreateService returns a new object of CreateServiceAPI.
+func NewCreateService(scopeID string, applicationService *ApplicationService) *CreateServiceAPI {
+	this := new(CreateServiceAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPost, "/api/2.0/services/application/"+scopeID, applicationService, new(string))
+	return this
+}
+
+// GetResponse returns the ID of the created service.
+func (ca CreateServiceAPI) GetResponse() string {
+	return ca.ResponseObject().(string)
+}
+
+// GetServiceAPI api object
+type GetServiceAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetService returns a new object of GetServiceAPI.
+func NewGetService(serviceID string) *GetServiceAPI {
+	this := new(GetServiceAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/application/"+serviceID, nil, new(ApplicationService))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetServiceAPI.
+func (ga GetServiceAPI) GetResponse() *ApplicationService {
+	return ga.ResponseObject().(*ApplicationService)
+}
+
+// UpdateServiceAPI api object
+type UpdateServiceAPI struct {
+	*api.BaseAPI
+}
+
+// NewUpdateService returns a new object of UpdateServiceAPI.
+func NewUpdateService(serviceID string, applicationService *ApplicationService) *UpdateServiceAPI {
+	this := new(UpdateServiceAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodPut, "/api/2.0/services/application/"+serviceID, applicationService, new(string))
+	return this
+}
+
+// GetResponse returns the raw response of UpdateServiceAPI.
+func (ua UpdateServiceAPI) GetResponse() string {
+	return string(ua.RawResponse())
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/sky-uk/gonsx/api"
+	"net/http"
+)
+
+// VirtualMachines - <basicinfolist> response listing the virtual machines
+// NSX knows about.
+type VirtualMachines struct {
+	VirtualMachines []VirtualMachine `xml:"basicinfo"`
+}
+
+// VirtualMachine - <basicinfo> element of <basicinfolist>
+type VirtualMachine struct {
+	ObjectID           string                            `xml:"objectId"`
+	Name               string                            `xml:"name"`
+	ExtendedAttributes []VirtualMachineExtendedAttribute `xml:"extendedAttributes>extendedAttribute"`
+}
+
+// VirtualMachineExtendedAttribute - <extendedAttribute> element of <basicinfo>
+type VirtualMachineExtendedAttribute struct {
+	Name  string `xml:"name"`
+	Value string `xml:"value"`
+}
+
+// ExtendedAttribute returns the value of the named extended attribute, or "".
+func (vm VirtualMachine) ExtendedAttribute(name string) string {
+	for _, attribute := range vm.ExtendedAttributes {
+		if attribute.Name == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// GetAllVirtualMachinesAPI api object
+type GetAllVirtualMachinesAPI struct {
+	*api.BaseAPI
+}
+
+// NewGetAllVirtualMachines returns a new object of GetAllVirtualMachinesAPI,
+// listing the virtual machines which can be members of security groups in
+// the scope.
+func NewGetAllVirtualMachines(scopeID string) *GetAllVirtualMachinesAPI {
+	this := new(GetAllVirtualMachinesAPI)
+	this.BaseAPI = api.NewBaseAPI(http.MethodGet, "/api/2.0/services/securitygroup/scope/"+scopeID+"/members/VirtualMachine", nil, new(VirtualMachines))
+	return this
+}
+
+// GetResponse returns the ResponseObject of GetAllVirtualMachinesAPI.
+func (ga GetAllVirtualMachinesAPI) GetResponse() *VirtualMachines {
+	return ga.ResponseObject().(*VirtualMachines)
+}
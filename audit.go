@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// auditRedacted replaces secrets in the audit log.
+const auditRedacted = "********"
+
+var (
+	// auditSecretXMLElement matches the content of XML elements holding
+	// secrets, e.g. <password>, <preSharedKey> or <psk>.
+	auditSecretXMLElement = regexp.MustCompile(`(?i)(<[\w:]*(?:password|passwd|presharedkey|psk|secret|token)[\w:]*>)[^<]*(</)`)
+	// auditSecretJSONField matches the value of JSON fields holding secrets.
+	auditSecretJSONField = regexp.MustCompile(`(?i)("[\w-]*(?:password|passwd|presharedkey|psk|secret|token)[\w-]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+)
+
+// redactSecrets hides passwords, pre-shared keys and the like in a request
+// or response body.
+func redactSecrets(body string) string {
+	body = auditSecretXMLElement.ReplaceAllString(body, "${1}"+auditRedacted+"${2}")
+	return auditSecretJSONField.ReplaceAllString(body, `${1}"`+auditRedacted+`"`)
+}
+
+// auditRecord is a line of the audit log.
+type auditRecord struct {
+	Time         string  `json:"time"`
+	Method       string  `json:"method"`
+	URL          string  `json:"url"`
+	Status       int     `json:"status,omitempty"`
+	DurationMS   float64 `json:"duration_ms"`
+	Resource     string  `json:"resource,omitempty"`
+	ResourceID   string  `json:"resource_id,omitempty"`
+	RequestBody  string  `json:"request_body,omitempty"`
+	ResponseBody string  `json:"response_body,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// auditLog writes every NSX API call to audit_log_file as JSON lines.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening audit_log_file: %v", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+func (a *auditLog) write(record auditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("[WARN] Could not write the audit log: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Printf("[WARN] Could not write the audit log: %v", err)
+	}
+}
+
+// auditResource is the resource an NSX API call is made for. Terraform does
+// not tell providers the resource address, so the type and the ID stand in
+// for it.
+type auditResource struct {
+	name string
+	d    *schema.ResourceData
+}
+
+// audit records an NSX API call, if audit_log_file is set.
+func (nsxClient *NSXClient) audit(method, requestURL string, requestBody []byte, status int, responseBody []byte, start time.Time, err error) {
+	if nsxClient.auditLog == nil {
+		return
+	}
+
+	record := auditRecord{
+		Time:         start.UTC().Format(time.RFC3339Nano),
+		Method:       method,
+		URL:          requestURL,
+		Status:       status,
+		DurationMS:   float64(time.Since(start)) / float64(time.Millisecond),
+		RequestBody:  redactSecrets(string(requestBody)),
+		ResponseBody: redactSecrets(string(responseBody)),
+	}
+	if nsxClient.resource != nil {
+		record.Resource = nsxClient.resource.name
+		record.ResourceID = nsxClient.resource.d.Id()
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	nsxClient.auditLog.write(record)
+}
+
+// forResource returns a copy of the client which attributes its calls to the
+// resource in the audit log.
+func (nsxClient *NSXClient) forResource(name string, d *schema.ResourceData) *NSXClient {
+	client := *nsxClient
+	client.resource = &auditResource{name: name, d: d}
+	if nsxClient.local != nil {
+		client.local = nsxClient.local.forResource(name, d)
+	}
+	return &client
+}
+
+// auditResourceCalls makes the functions of the resource hand a client which
+// knows about the resource to the resource.
+func auditResourceCalls(name string, r *schema.Resource) {
+	wrap := func(f func(*schema.ResourceData, interface{}) error) func(*schema.ResourceData, interface{}) error {
+		if f == nil {
+			return nil
+		}
+		return func(d *schema.ResourceData, m interface{}) error {
+			return f(d, clientForResource(name, d, m))
+		}
+	}
+
+	r.Create = wrap(r.Create)
+	r.Read = wrap(r.Read)
+	r.Update = wrap(r.Update)
+	r.Delete = wrap(r.Delete)
+
+	if r.Importer != nil && r.Importer.State != nil {
+		state := r.Importer.State
+		r.Importer.State = func(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+			return state(d, clientForResource(name, d, m))
+		}
+	}
+}
+
+func clientForResource(name string, d *schema.ResourceData, m interface{}) interface{} {
+	if nsxclient, ok := m.(*NSXClient); ok && nsxclient.auditLog != nil {
+		return nsxclient.forResource(name, d)
+	}
+	return m
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/sky-uk/gonsx/api"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	testCases := map[string]string{
+		"<site><password>s3cret</password><name>a</name></site>":            "<site><password>********</password><name>a</name></site>",
+		"<ipsec><psk>abc</psk><preSharedKey>def</preSharedKey></ipsec>":     "<ipsec><psk>********</psk><preSharedKey>********</preSharedKey></ipsec>",
+		"<user><sharedSecret>x</sharedSecret><userName>a</userName></user>": "<user><sharedSecret>********</sharedSecret><userName>a</userName></user>",
+		`{"username": "admin", "password": "p\"w"}`:                         `{"username": "admin", "password": "********"}`,
+		`{"token":"abc","expiry":1}`:                                        `{"token":"********","expiry":1}`,
+		"<ipset><name>web</name></ipset>":                                   "<ipset><name>web</name></ipset>",
+	}
+
+	for body, expected := range testCases {
+		if actual := redactSecrets(body); actual != expected {
+			t.Errorf("redactSecrets(%q) = %q, expected %q", body, actual, expected)
+		}
+	}
+}
+
+type testAuditPayload struct {
+	XMLName  xml.Name `xml:"credentials"`
+	User     string   `xml:"user"`
+	Password string   `xml:"password"`
+}
+
+func TestAuditLog(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte("<basicinfolist><basicinfo><objectId>vm-1</objectId></basicinfo></basicinfolist>"))
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "nsx-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditLogFile := filepath.Join(dir, "audit.log")
+
+	config := Config{NSXServer: strings.TrimPrefix(server.URL, "https://"), Insecure: true, AuditLogFile: auditLogFile}
+	nsxclient, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nsxclient.Do(api.NewBaseAPI(http.MethodPost, "/api/2.0/test", &testAuditPayload{User: "admin", Password: "s3cret"}, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Provider().(*schema.Provider).ResourcesMap["nsx_security_tag_vm"]
+	d := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"security_tag_id": "securitytag-1",
+		"moid":            "vm-1",
+	})
+	if err := r.Create(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid audit log line %s: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected 3 audit records, got %d: %+v", len(records), records)
+	}
+
+	if records[0].Method != "POST" || records[0].Status != 200 || records[0].Resource != "" {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if strings.Contains(records[0].RequestBody, "s3cret") || !strings.Contains(records[0].RequestBody, "<user>admin</user>") {
+		t.Errorf("expected the password to be redacted, got %s", records[0].RequestBody)
+	}
+
+	put, get := records[1], records[2]
+	if put.Method != "PUT" || put.URL != server.URL+"/api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1" || put.Resource != "nsx_security_tag_vm" {
+		t.Errorf("unexpected record %+v", put)
+	}
+	if get.Method != "GET" || get.Resource != "nsx_security_tag_vm" || get.ResourceID != "securitytag-1:vm-1" || !strings.Contains(get.ResponseBody, "vm-1") {
+		t.Errorf("unexpected record %+v", get)
+	}
+	if get.Time == "" || get.DurationMS <= 0 {
+		t.Errorf("expected the time and duration of the call, got %+v", get)
+	}
+}
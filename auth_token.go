@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// nsxAuthTokenEndpoint issues the API tokens used instead of Basic auth, see
+// token_auth.
+const nsxAuthTokenEndpoint = "/api/2.0/services/auth/token"
+
+// defaultAuthTokenLifetime is how long NSX tokens are valid for unless
+// token_expiry_minutes says otherwise.
+const defaultAuthTokenLifetime = 90 * time.Minute
+
+// authTokenResponse is the answer of nsxAuthTokenEndpoint.
+type authTokenResponse struct {
+	XMLName xml.Name `xml:"authToken"`
+	Value   string   `xml:"value"`
+	// ExpiresOn is in milliseconds since the epoch.
+	ExpiresOn int64 `xml:"expiresOn"`
+}
+
+// authToken is the API token of an NSX Manager. It is refreshed once nine
+// tenths of its lifetime are over, so that long plans never send an expired
+// one.
+type authToken struct {
+	mu            sync.Mutex
+	expiryMinutes int
+	url           string
+	value         string
+	refreshAt     time.Time
+	now           func() time.Time
+}
+
+func newAuthToken(expiryMinutes int) *authToken {
+	return &authToken{expiryMinutes: expiryMinutes, now: time.Now}
+}
+
+// get returns a valid token for the NSX Manager at nsxURL. A token equal to
+// stale, which NSX Manager refused, is replaced by a fresh one.
+func (t *authToken) get(nsxClient *NSXClient, nsxURL, stale string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Tokens are only valid on the NSX Manager which issued them.
+	if t.value != "" && t.value != stale && t.url == nsxURL && t.now().Before(t.refreshAt) {
+		return t.value, nil
+	}
+
+	issuedAt := t.now()
+	response, err := nsxClient.requestAuthToken(nsxURL, t.expiryMinutes)
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := defaultAuthTokenLifetime
+	if t.expiryMinutes > 0 {
+		lifetime = time.Duration(t.expiryMinutes) * time.Minute
+	}
+	// Unless the clocks disagree, the expiry NSX Manager tells is the one
+	// that counts.
+	if response.ExpiresOn > 0 {
+		if expiresIn := time.Unix(0, response.ExpiresOn*int64(time.Millisecond)).Sub(issuedAt); expiresIn > 0 {
+			lifetime = expiresIn
+		}
+	}
+
+	t.url = nsxURL
+	t.value = response.Value
+	t.refreshAt = issuedAt.Add(lifetime - lifetime/10)
+	log.Printf("[DEBUG] Obtained an NSX API token from %s, refreshing it at %s", nsxURL, t.refreshAt.Format(time.RFC3339))
+	return t.value, nil
+}
+
+// requestAuthToken asks the NSX Manager at nsxURL for a new token, using
+// Basic auth. It is the one POST made with read_only = true, as it changes
+// nothing NSX manages.
+func (nsxClient *NSXClient) requestAuthToken(nsxURL string, expiryMinutes int) (*authTokenResponse, error) {
+	requestURL := nsxURL + nsxAuthTokenEndpoint
+	if expiryMinutes > 0 {
+		requestURL = fmt.Sprintf("%s?expiresInMinutes=%d", requestURL, expiryMinutes)
+	}
+	req, err := http.NewRequest(http.MethodPost, requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(nsxClient.User, nsxClient.Password)
+
+	// The token itself is left out of the audit log.
+	release := nsxClient.throttle(http.MethodPost, nsxAuthTokenEndpoint)
+	start := time.Now()
+	res, err := nsxClient.HTTPClient.Do(req)
+	if err != nil {
+		release()
+		nsxClient.audit(http.MethodPost, requestURL, nil, 0, nil, start, err)
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	release()
+	nsxClient.audit(http.MethodPost, requestURL, nil, res.StatusCode, nil, start, err)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("Error obtaining an NSX API token from %s: status code %d: %s", nsxURL, res.StatusCode, body)
+	}
+
+	response := new(authTokenResponse)
+	if err := xml.Unmarshal(body, response); err != nil {
+		return nil, fmt.Errorf("Error reading the NSX API token of %s: %v", nsxURL, err)
+	}
+	if response.Value == "" {
+		return nil, fmt.Errorf("Error reading the NSX API token of %s: no token in %s", nsxURL, body)
+	}
+	return response, nil
+}
+
+// authorize adds the credentials to a request to the NSX Manager at nsxURL
+// and returns the token used, if any. stale is a token to replace.
+func (nsxClient *NSXClient) authorize(req *http.Request, nsxURL, stale string) (string, error) {
+	if nsxClient.token == nil {
+		req.SetBasicAuth(nsxClient.User, nsxClient.Password)
+		return "", nil
+	}
+
+	token, err := nsxClient.token.get(nsxClient, nsxURL, stale)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "AUTHTOKEN "+token)
+	return token, nil
+}
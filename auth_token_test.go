@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTokenServer issues API tokens and only accepts the current one.
+type testTokenServer struct {
+	mu      sync.Mutex
+	issued  int
+	current string
+	expiry  string
+	denied  bool
+}
+
+func (s *testTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == nsxAuthTokenEndpoint {
+		if user, password, ok := r.BasicAuth(); r.Method != http.MethodPost || !ok || user != "user" || password != "password" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.issued++
+		s.current = fmt.Sprintf("token-%d", s.issued)
+		s.expiry = r.URL.Query().Get("expiresInMinutes")
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, "<authToken><value>%s</value><expiresOn>%d</expiresOn></authToken>", s.current, time.Now().Add(30*time.Minute).UnixNano()/int64(time.Millisecond))
+		return
+	}
+
+	if _, _, ok := r.BasicAuth(); ok || s.denied || r.Header.Get("Authorization") != "AUTHTOKEN "+s.current {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, "<virtualMachines></virtualMachines>")
+}
+
+func TestTokenAuth(t *testing.T) {
+	tokenServer := &testTokenServer{}
+	server := httptest.NewTLSServer(tokenServer)
+	defer server.Close()
+
+	config := Config{NSXServer: strings.TrimPrefix(server.URL, "https://"), NSXUserName: "user", NSXPassword: "password", Insecure: true, TokenAuth: true, TokenExpiryMinutes: 30}
+	nsxclient, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenServer.issued != 1 || tokenServer.expiry != "30" {
+		t.Fatalf("expected a token for 30 minutes at configure time, got %d tokens for %s minutes", tokenServer.issued, tokenServer.expiry)
+	}
+
+	get := func() int {
+		getAPI := NewGetAllVirtualMachines("globalroot-0")
+		if err := nsxclient.Do(getAPI); err != nil {
+			t.Fatal(err)
+		}
+		return getAPI.StatusCode()
+	}
+
+	if status := get(); status != 200 || tokenServer.issued != 1 {
+		t.Fatalf("expected the token to be reused, got status code %d after %d tokens", status, tokenServer.issued)
+	}
+
+	// NSX Manager forgot the token.
+	tokenServer.current = "forgotten"
+	if status := get(); status != 200 || tokenServer.issued != 2 {
+		t.Fatalf("expected a retry with a new token, got status code %d after %d tokens", status, tokenServer.issued)
+	}
+
+	// The token is about to expire.
+	nsxclient.token.now = func() time.Time { return time.Now().Add(28 * time.Minute) }
+	if status := get(); status != 200 || tokenServer.issued != 3 {
+		t.Fatalf("expected the token to be refreshed before expiry, got status code %d after %d tokens", status, tokenServer.issued)
+	}
+	nsxclient.token.now = time.Now
+
+	// The user may not make the call, whatever the token.
+	tokenServer.denied = true
+	if status := get(); status != 403 || tokenServer.issued != 4 {
+		t.Fatalf("expected a single retry, got status code %d after %d tokens", status, tokenServer.issued)
+	}
+}
+
+func TestTokenAuthConfigureError(t *testing.T) {
+	server := httptest.NewTLSServer(&testTokenServer{})
+	defer server.Close()
+
+	config := Config{NSXServer: strings.TrimPrefix(server.URL, "https://"), NSXUserName: "user", NSXPassword: "wrong", Insecure: true, TokenAuth: true}
+	if _, err := config.Client(); err == nil || !strings.Contains(err.Error(), "Error obtaining an NSX API token") {
+		t.Fatalf("expected the token request to fail, got %v", err)
+	}
+}
+
+func TestTokenAndHealthCheckRequestsAreThrottled(t *testing.T) {
+	tokenServer := &testTokenServer{}
+	server := httptest.NewServer(tokenServer)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "nsx-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	auditLogFile := filepath.Join(dir, "audit.log")
+
+	var waits []time.Duration
+	limiter := newRateLimiter(1, 1)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+
+	nsxclient := NewNSXClient(server.URL, "user", "password", true, false)
+	nsxclient.managers = newNSXManagers(testUnreachableURL(t), server.URL)
+	nsxclient.limiter = limiter
+	// A single slot must not deadlock the request which needs a token.
+	nsxclient.requests = newSemaphore(1)
+	nsxclient.readOnly = true
+	nsxclient.token = newAuthToken(0)
+	nsxclient.auditLog, err = openAuditLog(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nsxclient.selectHealthy(); err != nil {
+		t.Fatal(err)
+	}
+	getAPI := NewGetAllVirtualMachines("globalroot-0")
+	if err := nsxclient.Do(getAPI); err != nil {
+		t.Fatal(err)
+	}
+	if getAPI.StatusCode() != http.StatusOK || tokenServer.issued != 1 {
+		t.Fatalf("expected the GET to succeed with a token even with read_only, got status code %d after %d tokens", getAPI.StatusCode(), tokenServer.issued)
+	}
+
+	// Two health checks, the token request and the GET.
+	if len(waits) != 3 {
+		t.Fatalf("expected every request to wait for max_requests_per_second, got %v", waits)
+	}
+
+	content, err := ioutil.ReadFile(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record auditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid audit log line %s: %v", line, err)
+		}
+		calls = append(calls, record.Method+" "+strings.SplitN(record.URL, "/api/", 2)[1])
+	}
+	expected := []string{
+		"GET 2.0/universalsync/configuration/role",
+		"GET 2.0/universalsync/configuration/role",
+		"POST 2.0/services/auth/token",
+		"GET 2.0/services/securitygroup/scope/globalroot-0/members/VirtualMachine",
+	}
+	if strings.Join(calls, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("expected the audit log to record %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"github.com/sky-uk/gonsx/api"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nsxHealthCheckEndpoint is a cheap call every NSX Manager answers, whatever
+// its cross-vCenter role.
+const nsxHealthCheckEndpoint = "/api/2.0/universalsync/configuration/role"
+
+// NSXClient makes the NSX API calls. It mirrors gonsx.NSXClient, which
+// builds a new transport for every call, but keeps a single http.Client so
+// that the transport can be configured by the provider.
+type NSXClient struct {
+	User       string
+	Password   string
+	HTTPClient *http.Client
+	debug      bool
+
+	managers *nsxManagers
+
+	// local, if set, manages the non universal objects.
+	local *NSXClient
+
+	// limiter and requests throttle the calls to NSX Manager, see
+	// max_requests_per_second and max_concurrent_requests.
+	limiter  *rateLimiter
+	requests semaphore
+
+	// readOnly refuses every request which could change NSX, see read_only.
+	readOnly bool
+
+	// auditLog records every call, for resource, see audit_log_file.
+	auditLog *auditLog
+	resource *auditResource
+
+	// token, if set, replaces Basic auth, see token_auth.
+	token *authToken
+}
+
+// NewNSXClient returns a new NSXClient using a default transport.
+func NewNSXClient(url string, user string, password string, ignoreSSL bool, debug bool) *NSXClient {
+	return &NSXClient{
+		managers: newNSXManagers(url),
+		User:     user,
+		Password: password,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: ignoreSSL},
+			},
+		},
+		debug: debug,
+	}
+}
+
+// nsxManagers are the URLs of the NSX Managers in order of preference.
+// Requests go to the current one until it stops accepting connections.
+type nsxManagers struct {
+	mu      sync.Mutex
+	urls    []string
+	current int
+}
+
+func newNSXManagers(urls ...string) *nsxManagers {
+	return &nsxManagers{urls: urls}
+}
+
+// URL returns the NSX Manager requests currently go to.
+func (m *nsxManagers) URL() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.urls[m.current]
+}
+
+// failover moves to the NSX Manager after failedURL, unless another request
+// already did.
+func (m *nsxManagers) failover(failedURL string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.urls) > 1 && m.urls[m.current] == failedURL {
+		m.current = (m.current + 1) % len(m.urls)
+		log.Printf("[WARN] NSX Manager %s is unreachable, failing over to %s", failedURL, m.urls[m.current])
+	}
+}
+
+// use makes the i-th NSX Manager the current one.
+func (m *nsxManagers) use(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = i
+}
+
+// URL returns the NSX Manager requests currently go to.
+func (nsxClient *NSXClient) URL() string {
+	return nsxClient.managers.URL()
+}
+
+// selectHealthy makes the first NSX Manager which answers the health check
+// the current one.
+func (nsxClient *NSXClient) selectHealthy() error {
+	var errs []string
+	for i, nsxURL := range nsxClient.managers.urls {
+		req, err := http.NewRequest(http.MethodGet, nsxURL+nsxHealthCheckEndpoint, nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(nsxClient.User, nsxClient.Password)
+
+		release := nsxClient.throttle(req.Method, nsxHealthCheckEndpoint)
+		start := time.Now()
+		res, err := nsxClient.HTTPClient.Do(req)
+		if err != nil {
+			release()
+			nsxClient.audit(req.Method, req.URL.String(), nil, 0, nil, start, err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		res.Body.Close()
+		release()
+		nsxClient.audit(req.Method, req.URL.String(), nil, res.StatusCode, nil, start, nil)
+		if res.StatusCode >= 500 {
+			errs = append(errs, fmt.Sprintf("%s: status code %d", nsxURL, res.StatusCode))
+			continue
+		}
+
+		log.Printf("[INFO] Using NSX Manager %s", nsxURL)
+		nsxClient.managers.use(i)
+		return nil
+	}
+	return fmt.Errorf("None of the NSX Managers is healthy: %s", strings.Join(errs, "; "))
+}
+
+// isConnectionError returns whether err means the request never reached
+// NSX Manager, so that it is safe to send it to another one.
+func isConnectionError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// isReadOnlyMethod returns whether an HTTP method leaves NSX unchanged.
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// throttle waits until a request may be sent to NSX Manager and returns the
+// function to call once its response has been read. Every HTTP request goes
+// through it, including the health checks and the token requests, so that
+// they count against max_concurrent_requests and max_requests_per_second.
+func (nsxClient *NSXClient) throttle(method, endpoint string) func() {
+	if wait := nsxClient.requests.Acquire(); wait > 0 {
+		log.Printf("[DEBUG] Waited %s for one of the max_concurrent_requests before %s %s", wait, method, endpoint)
+	}
+	if wait := nsxClient.limiter.Wait(); wait > 0 {
+		log.Printf("[DEBUG] Waited %s for max_requests_per_second before %s %s", wait, method, endpoint)
+	}
+	return nsxClient.requests.Release
+}
+
+// Do makes the API call.
+func (nsxClient *NSXClient) Do(api api.NSXApi) error {
+	if nsxClient.readOnly && !isReadOnlyMethod(api.Method()) {
+		return fmt.Errorf("The NSX provider is configured with read_only = true, refusing to %s %s", api.Method(), api.Endpoint())
+	}
+
+	var requestXMLBytes []byte
+	if api.RequestObject() != nil {
+		var err error
+		requestXMLBytes, err = xml.Marshal(api.RequestObject())
+		if err != nil {
+			return err
+		}
+		if nsxClient.debug {
+			log.Printf(fmt.Sprintf("[DEBUG] XmlPayload : %s", requestXMLBytes))
+		}
+	}
+
+	var err error
+	for range nsxClient.managers.urls {
+		nsxURL := nsxClient.managers.URL()
+		err = nsxClient.do(nsxURL, api, requestXMLBytes)
+		if err == nil || !isConnectionError(err) {
+			return err
+		}
+		nsxClient.managers.failover(nsxURL)
+	}
+	return err
+}
+
+func (nsxClient *NSXClient) do(nsxURL string, api api.NSXApi, requestXMLBytes []byte) error {
+	requestURL := fmt.Sprintf("%s%s", nsxURL, api.Endpoint())
+
+	if nsxClient.debug {
+		log.Printf(fmt.Sprintf("[DEBUG] requestURL: %s", requestURL))
+	}
+
+	var token string
+	for attempt := 1; ; attempt++ {
+		var requestPayload io.Reader
+		if requestXMLBytes != nil {
+			requestPayload = bytes.NewReader(requestXMLBytes)
+		}
+		req, err := http.NewRequest(api.Method(), requestURL, requestPayload)
+		if err != nil {
+			log.Println("ERROR building the request: ", err)
+			return err
+		}
+
+		// The token, if it has to be requested, is obtained before the
+		// request is throttled, as the token request is throttled itself.
+		// Headers set on the API object, e.g. If-Match by the firewall
+		// APIs, go along, but never replace the credentials.
+		for name, values := range api.RequestHeaders() {
+			if http.CanonicalHeaderKey(name) != "Authorization" {
+				req.Header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		token, err = nsxClient.authorize(req, nsxURL, token)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/xml")
+
+		release := nsxClient.throttle(api.Method(), api.Endpoint())
+		start := time.Now()
+		res, err := nsxClient.HTTPClient.Do(req)
+		if err != nil {
+			release()
+			log.Println("ERROR executing request: ", err)
+			nsxClient.audit(api.Method(), requestURL, requestXMLBytes, 0, nil, start, err)
+			return err
+		}
+
+		// NSX Manager refuses tokens it has forgotten, e.g. after a restart,
+		// so the request is retried once with a fresh one.
+		if res.StatusCode == http.StatusForbidden && token != "" && attempt == 1 {
+			res.Body.Close()
+			release()
+			nsxClient.audit(api.Method(), requestURL, requestXMLBytes, res.StatusCode, nil, start, nil)
+			log.Printf("[DEBUG] NSX Manager %s refused the API token, retrying %s %s with a new one", nsxURL, api.Method(), api.Endpoint())
+			continue
+		}
+
+		err = nsxClient.handleResponse(api, res)
+		res.Body.Close()
+		release()
+		nsxClient.audit(api.Method(), requestURL, requestXMLBytes, res.StatusCode, api.RawResponse(), start, err)
+		return err
+	}
+}
+
+// responseHeaderSetter is implemented by api.BaseAPI, but is not part of
+// api.NSXApi.
+type responseHeaderSetter interface {
+	SetResponseHeader(http.Header)
+}
+
+func (nsxClient *NSXClient) handleResponse(api api.NSXApi, res *http.Response) error {
+	api.SetStatusCode(res.StatusCode)
+	if setter, ok := api.(responseHeaderSetter); ok {
+		setter.SetResponseHeader(res.Header)
+	}
+	bodyText, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		log.Println("ERROR reading response: ", err)
+		return err
+	}
+
+	api.SetRawResponse(bodyText)
+
+	if nsxClient.debug {
+		log.Println("STATUS CODE: ", api.StatusCode())
+		log.Println(string(bodyText))
+	}
+	if isXMLContentType(res.Header.Get("Content-Type")) && api.StatusCode() == 200 {
+		// Some NSX calls answer 200 with an empty body, or have no
+		// response object to fill.
+		if api.ResponseObject() == nil || len(bytes.TrimSpace(bodyText)) == 0 {
+			return nil
+		}
+		if err := xml.Unmarshal(bodyText, api.ResponseObject()); err != nil {
+			log.Println("ERROR unmarshalling response: ", err)
+			return err
+		}
+		if nsxClient.debug {
+			log.Printf(fmt.Sprintf("[DEBUG] Response : %+v", api.ResponseObject()))
+		}
+	} else {
+		api.SetResponseObject(string(bodyText))
+		if nsxClient.debug {
+			log.Printf(fmt.Sprintf("[DEBUG] Body Txt : %s", string(bodyText)))
+		}
+	}
+	return nil
+}
+
+func isXMLContentType(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "/xml")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/sky-uk/gonsx/api"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testUnreachableURL returns the URL of a port nothing listens on.
+func testUnreachableURL(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return "http://" + listener.Addr().String()
+}
+
+func TestNSXClientFailover(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	unreachable := testUnreachableURL(t)
+	nsxclient := NewNSXClient(unreachable, "user", "password", true, false)
+	nsxclient.managers = newNSXManagers(unreachable, server.URL)
+
+	createAPI := NewCreateSecurityTag(&SecurityTag{Name: "web"})
+	if err := nsxclient.Do(createAPI); err != nil {
+		t.Fatal(err)
+	}
+	if createAPI.StatusCode() != 201 {
+		t.Fatalf("unexpected status code %d", createAPI.StatusCode())
+	}
+	if nsxclient.URL() != server.URL {
+		t.Fatalf("expected to stay on %s, got %s", server.URL, nsxclient.URL())
+	}
+	if len(bodies) != 1 || !strings.Contains(bodies[0], "<name>web</name>") {
+		t.Fatalf("expected the request body to be sent once to the second manager, got %v", bodies)
+	}
+
+	// Errors other than connection errors are not retried elsewhere.
+	nsxclient.managers = newNSXManagers(server.URL, unreachable)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	getAPI := NewGetAllVirtualMachines("globalroot-0")
+	if err := nsxclient.Do(getAPI); err != nil {
+		t.Fatal(err)
+	}
+	if getAPI.StatusCode() != 500 || nsxclient.URL() != server.URL {
+		t.Fatalf("expected a 500 from %s, got %d from %s", server.URL, getAPI.StatusCode(), nsxclient.URL())
+	}
+}
+
+func TestNSXClientSelectHealthy(t *testing.T) {
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != nsxHealthCheckEndpoint {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte("<universalSyncRole><role>SECONDARY</role></universalSyncRole>"))
+	}))
+	defer healthy.Close()
+
+	nsxclient := NewNSXClient(unhealthy.URL, "user", "password", true, false)
+	nsxclient.managers = newNSXManagers(testUnreachableURL(t), unhealthy.URL, healthy.URL)
+	if err := nsxclient.selectHealthy(); err != nil {
+		t.Fatal(err)
+	}
+	if nsxclient.URL() != healthy.URL {
+		t.Fatalf("expected %s to be selected, got %s", healthy.URL, nsxclient.URL())
+	}
+
+	nsxclient.managers = newNSXManagers(unhealthy.URL)
+	if err := nsxclient.selectHealthy(); err == nil || !strings.Contains(err.Error(), "None of the NSX Managers is healthy") {
+		t.Fatalf("expected no healthy manager, got %v", err)
+	}
+}
+
+func TestNSXClientFor(t *testing.T) {
+	primary := NewNSXClient("https://primary", "user", "password", true, false)
+	if nsxClientFor(nil, primary) != primary {
+		t.Fatal("expected the primary manager without local_nsxserver")
+	}
+
+	local := NewNSXClient("https://secondary", "user", "password", true, false)
+	primary.local = local
+
+	testCases := []struct {
+		resource  string
+		config    map[string]interface{}
+		universal bool
+	}{
+		{"nsx_ip_set", map[string]interface{}{"name": "web", "scopeid": "globalroot-0"}, false},
+		{"nsx_ip_set", map[string]interface{}{"name": "web", "universal": true}, true},
+		{"nsx_ip_set", map[string]interface{}{"name": "web", "scopeid": universalScopeID}, true},
+		{"nsx_logical_switch", map[string]interface{}{"name": "web", "scopeid": "universalvdnscope"}, true},
+		{"nsx_nat_rule", map[string]interface{}{"edgeid": "edge-1"}, false},
+	}
+
+	resources := Provider().(*schema.Provider).ResourcesMap
+	for _, testCase := range testCases {
+		d := schema.TestResourceDataRaw(t, resources[testCase.resource].Schema, testCase.config)
+		expected := local
+		if testCase.universal {
+			expected = primary
+		}
+		if actual := nsxClientFor(d, primary); actual != expected {
+			t.Errorf("%s %v: expected %s, got %s", testCase.resource, testCase.config, expected.URL(), actual.URL())
+		}
+	}
+}
+
+func TestNSXClientReadOnly(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	nsxserver := strings.TrimPrefix(server.URL, "https://")
+
+	config := Config{NSXServer: nsxserver, LocalNSXServer: nsxserver, Insecure: true, ReadOnly: true}
+	nsxclient, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nsxclient.Do(NewGetAllVirtualMachines("globalroot-0")); err != nil {
+		t.Fatalf("expected reads to be allowed, got %v", err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityTagVM().Schema, map[string]interface{}{
+		"security_tag_id": "securitytag-1",
+		"moid":            "vm-1",
+	})
+	err = resourceSecurityTagVMCreate(d, nsxclient)
+	if err == nil || !strings.Contains(err.Error(), "read_only = true, refusing to PUT /api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1") {
+		t.Fatalf("expected the create to be refused, got %v", err)
+	}
+
+	for _, client := range []*NSXClient{nsxclient, nsxclient.local} {
+		if err := client.Do(NewCreateSecurityTag(&SecurityTag{Name: "web"})); err == nil {
+			t.Fatal("expected a POST to be refused")
+		}
+		if err := client.Do(NewRemoveSecurityPolicyBinding("policy-1", "securitygroup-1")); err == nil {
+			t.Fatal("expected a DELETE to be refused")
+		}
+	}
+
+	if len(methods) != 1 || methods[0] != http.MethodGet {
+		t.Fatalf("expected only the GET to reach NSX, got %v", methods)
+	}
+}
+
+func TestNSXClientEmptyXMLResponse(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodPut, "/api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusOK)
+	})
+	server.respond("/api/2.0/services/securitytags/tag", " \n")
+	nsxclient := server.client()
+
+	attachAPI := api.NewBaseAPI(http.MethodPut, "/api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1", nil, nil)
+	if err := nsxclient.Do(attachAPI); err != nil {
+		t.Fatalf("expected an empty reply without response object to be accepted, got %v", err)
+	}
+	getAPI := NewGetAllSecurityTags(false)
+	if err := nsxclient.Do(getAPI); err != nil {
+		t.Fatalf("expected an empty reply to be accepted, got %v", err)
+	}
+	if getAPI.StatusCode() != http.StatusOK {
+		t.Fatalf("unexpected status code %d", getAPI.StatusCode())
+	}
+}
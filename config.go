@@ -1,22 +1,224 @@
 package main
 
 import (
-	"github.com/sky-uk/gonsx"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"golang.org/x/net/http/httpproxy"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // Config is a struct for containing the provider parameters.
 type Config struct {
-	Debug       bool
-	Insecure    bool
-	NSXUserName string
-	NSXPassword string
-	NSXServer   string
+	Debug          bool
+	Insecure       bool
+	NSXUserName    string
+	NSXPassword    string
+	NSXServer      string
+	CAFile         string
+	CAPEM          string
+	ClientCertFile string
+	ClientKeyFile  string
+	TLSServerName  string
+
+	ProxyURL       string
+	NoProxy        string
+	RequestTimeout int
+	MaxIdleConns   int
+
+	MaxRequestsPerSecond  float64
+	MaxConcurrentRequests int
+
+	// NSXServers are more NSX Managers to fail over to, after NSXServer.
+	NSXServers []string
+	// LocalNSXServer manages the non universal objects, typically a
+	// secondary NSX Manager in a cross-vCenter deployment.
+	LocalNSXServer string
+
+	// ReadOnly makes the client refuse every POST, PUT and DELETE.
+	ReadOnly bool
+
+	// AuditLogFile receives a JSON line for every NSX API call.
+	AuditLogFile string
+
+	// TokenAuth authenticates with an API token, obtained with the user and
+	// password, instead of sending them with every call.
+	TokenAuth          bool
+	TokenExpiryMinutes int
+
+	// CredentialsFile and CredentialProcess provide the user and password
+	// when they are not configured, see loadCredentials.
+	CredentialsFile   string
+	Profile           string
+	CredentialProcess string
 }
 
+// nsxURLs returns the URLs of NSXServer and NSXServers, without duplicates.
+func (c *Config) nsxURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, server := range append([]string{c.NSXServer}, c.NSXServers...) {
+		if server == "" || seen[server] {
+			continue
+		}
+		seen[server] = true
+		urls = append(urls, "https://"+server)
+	}
+	return urls
+}
+
+// tlsConfig returns the TLS configuration used to talk to NSX Manager.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		ServerName:         c.TLSServerName,
+	}
+
+	caPEM := []byte(c.CAPEM)
+	if c.CAFile != "" {
+		var err error
+		caPEM, err = ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading ca_file: %v", err)
+		}
+	}
+	if len(caPEM) > 0 {
+		// Trust the system roots as well as the internal CA.
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("No certificates found in the CA bundle")
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if c.ClientCertFile != "" || c.ClientKeyFile != "" {
+		if c.ClientCertFile == "" || c.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client_cert_file and client_key_file must be provided together")
+		}
+		certificate, err := tls.LoadX509KeyPair(c.ClientCertFile, c.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading the client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// proxy returns the proxy function of the transport. Without proxy_url the
+// usual HTTPS_PROXY and NO_PROXY environment variables apply.
+func (c *Config) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if _, err := url.Parse(c.ProxyURL); err != nil {
+		return nil, fmt.Errorf("Invalid proxy_url: %v", err)
+	}
+	proxyConfig := &httpproxy.Config{
+		HTTPProxy:  c.ProxyURL,
+		HTTPSProxy: c.ProxyURL,
+		NoProxy:    c.NoProxy,
+	}
+	proxyFunc := proxyConfig.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}, nil
+}
+
+// requestTimeoutUnit is the unit of request_timeout.
+var requestTimeoutUnit = time.Second
+
 // Client returns a new client for accessing VMWare vSphere.
-func (c *Config) Client() (*gonsx.NSXClient, error) {
-	log.Printf("[INFO] VMWare NSX Client configured for URL: %s", c.NSXServer)
-	nsxclient := gonsx.NewNSXClient("https://"+c.NSXServer, c.NSXUserName, c.NSXPassword, c.Insecure, c.Debug)
+func (c *Config) Client() (*NSXClient, error) {
+	nsxURLs := c.nsxURLs()
+	if len(nsxURLs) == 0 {
+		return nil, fmt.Errorf("nsxserver or nsxservers must be provided")
+	}
+	log.Printf("[INFO] VMWare NSX Client configured for URLs: %s", strings.Join(nsxURLs, ", "))
+
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := c.proxy()
+	if err != nil {
+		return nil, err
+	}
+
+	// NSX Manager is a single host, so the per host idle limit is the one
+	// that matters.
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		Proxy:               proxy,
+		MaxIdleConns:        c.MaxIdleConns,
+		MaxIdleConnsPerHost: c.MaxIdleConns,
+		IdleConnTimeout:     90 * time.Second,
+	}
+
+	nsxclient := NewNSXClient(nsxURLs[0], c.NSXUserName, c.NSXPassword, c.Insecure, c.Debug)
+	nsxclient.managers = newNSXManagers(nsxURLs...)
+	nsxclient.HTTPClient = &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(c.RequestTimeout) * requestTimeoutUnit,
+	}
+	nsxclient.limiter = newRateLimiter(c.MaxRequestsPerSecond, int(c.MaxRequestsPerSecond))
+	nsxclient.requests = newSemaphore(c.MaxConcurrentRequests)
+	nsxclient.readOnly = c.ReadOnly
+	if c.AuditLogFile != "" {
+		nsxclient.auditLog, err = openAuditLog(c.AuditLogFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.ReadOnly {
+		log.Printf("[INFO] NSX provider is read only")
+	}
+
+	// With a single NSX Manager there is nothing to choose from.
+	if len(nsxURLs) > 1 {
+		if err := nsxclient.selectHealthy(); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.TokenAuth {
+		nsxclient.token = newAuthToken(c.TokenExpiryMinutes)
+		if _, err := nsxclient.token.get(nsxclient, nsxclient.URL(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.LocalNSXServer != "" {
+		// The local NSX Manager shares the transport and the limits.
+		nsxclient.local = &NSXClient{
+			User:       nsxclient.User,
+			Password:   nsxclient.Password,
+			HTTPClient: nsxclient.HTTPClient,
+			debug:      nsxclient.debug,
+			managers:   newNSXManagers("https://" + c.LocalNSXServer),
+			limiter:    nsxclient.limiter,
+			requests:   nsxclient.requests,
+			readOnly:   nsxclient.readOnly,
+			auditLog:   nsxclient.auditLog,
+		}
+		// Tokens are only valid on the NSX Manager which issued them.
+		if c.TokenAuth {
+			nsxclient.local.token = newAuthToken(c.TokenExpiryMinutes)
+			if _, err := nsxclient.local.token.get(nsxclient.local, nsxclient.local.URL(), ""); err != nil {
+				return nil, err
+			}
+		}
+		log.Printf("[INFO] Non universal objects are managed by %s", c.LocalNSXServer)
+	}
 	return nsxclient, nil
 }
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/sky-uk/gonsx/api"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClientCertificate writes a self-signed client certificate and its key
+// to dir and returns the certificate.
+func testClientCertificate(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "terraform"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(filepath.Join(dir, "client.pem"), certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "client-key.pem"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func TestConfigClientTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nsx-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientCertificate := testClientCertificate(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCertificate)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, []byte(caPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	clientCertFile := filepath.Join(dir, "client.pem")
+	clientKeyFile := filepath.Join(dir, "client-key.pem")
+	nsxserver := strings.TrimPrefix(server.URL, "https://")
+
+	testCases := []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"ca_pem and client certificate", Config{CAPEM: caPEM, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}, true},
+		{"ca_file and client certificate", Config{CAFile: caFile, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}, true},
+		{"server name override", Config{CAPEM: caPEM, TLSServerName: "example.com", ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}, true},
+		{"wrong server name", Config{CAPEM: caPEM, TLSServerName: "nsx.example.org", ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}, false},
+		{"unknown CA", Config{ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile}, false},
+		{"no client certificate", Config{CAPEM: caPEM}, false},
+	}
+
+	for _, testCase := range testCases {
+		config := testCase.config
+		config.NSXServer = nsxserver
+		config.NSXUserName = "user"
+		config.NSXPassword = "password"
+
+		nsxclient, err := config.Client()
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+		api := NewGetAllVirtualMachines("globalroot-0")
+		err = nsxclient.Do(api)
+		if testCase.ok && (err != nil || api.StatusCode() != 200) {
+			t.Errorf("%s: expected the request to succeed, got %v", testCase.name, err)
+		}
+		if !testCase.ok && err == nil {
+			t.Errorf("%s: expected the TLS handshake to fail", testCase.name)
+		}
+	}
+}
+
+func TestConfigTLSErrors(t *testing.T) {
+	testCases := map[string]Config{
+		"No certificates found":    {CAPEM: "not a certificate"},
+		"must be provided":         {ClientCertFile: "client.pem"},
+		"Error reading ca_file":    {CAFile: "/nonexistent/ca.pem"},
+		"Error loading the client": {ClientCertFile: "/nonexistent/client.pem", ClientKeyFile: "/nonexistent/client-key.pem"},
+	}
+
+	for expected, config := range testCases {
+		config.NSXServer = "nsx.example.com"
+		_, err := config.Client()
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+// testProxy is a stand-in for a corporate proxy which tunnels CONNECT
+// requests to upstream and records the hosts it tunnelled to. Loopback
+// addresses are never proxied, so the tests use a made up host name.
+type testProxy struct {
+	upstream string
+	mu       sync.Mutex
+	hosts    []string
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	p.mu.Lock()
+	p.hosts = append(p.hosts, r.Host)
+	p.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", p.upstream)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+func (p *testProxy) tunnelled() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.hosts...)
+}
+
+func TestConfigClientProxy(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	upstream := strings.TrimPrefix(server.URL, "https://")
+	nsxserver := "nsx.example.test:" + upstream[strings.LastIndex(upstream, ":")+1:]
+
+	proxy := &testProxy{upstream: upstream}
+	proxyServer := httptest.NewServer(proxy)
+	defer proxyServer.Close()
+
+	config := Config{NSXServer: nsxserver, Insecure: true, ProxyURL: proxyServer.URL}
+	nsxclient, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nsxclient.Do(NewGetAllVirtualMachines("globalroot-0")); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := proxy.tunnelled(); len(hosts) != 1 || hosts[0] != nsxserver {
+		t.Fatalf("expected the request to be tunnelled to %s, got %v", nsxserver, hosts)
+	}
+
+	// The made up host name does not resolve, so the request fails when it
+	// bypasses the proxy.
+	config.NoProxy = "10.0.0.0/8,.example.test"
+	nsxclient, err = config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsxclient.Do(NewGetAllVirtualMachines("globalroot-0"))
+	if hosts := proxy.tunnelled(); len(hosts) != 1 {
+		t.Fatalf("expected no_proxy to bypass the proxy, got %v", hosts)
+	}
+}
+
+func TestConfigClientConnectionLimits(t *testing.T) {
+	defer func(unit time.Duration) { requestTimeoutUnit = unit }(requestTimeoutUnit)
+	requestTimeoutUnit = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	connections := map[string]bool{}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections[r.RemoteAddr] = true
+		mu.Unlock()
+
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+
+	config := Config{NSXServer: strings.TrimPrefix(server.URL, "https://"), Insecure: true, MaxIdleConns: 2, RequestTimeout: 1}
+	nsxclient, err := config.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nsxclient.HTTPClient.Timeout != 50*time.Millisecond {
+		t.Fatalf("expected a timeout of one request_timeout unit, got %s", nsxclient.HTTPClient.Timeout)
+	}
+	transport := nsxclient.HTTPClient.Transport.(*http.Transport)
+	if transport.MaxIdleConns != 2 || transport.MaxIdleConnsPerHost != 2 {
+		t.Fatalf("expected 2 idle connections, got %d and %d per host", transport.MaxIdleConns, transport.MaxIdleConnsPerHost)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := nsxclient.Do(NewGetAllVirtualMachines("globalroot-0")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(connections) != 1 {
+		t.Fatalf("expected the idle connection to be reused, got %d connections", len(connections))
+	}
+
+	slowAPI := api.NewBaseAPI(http.MethodGet, "/slow", nil, nil)
+	if err := nsxclient.Do(slowAPI); err == nil {
+		t.Fatal("expected the request to time out")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultCredentialsProfile is the profile of credentials_file used unless
+// profile says otherwise.
+const defaultCredentialsProfile = "default"
+
+// credentialProcessTimeout is how long credential_process may take.
+const credentialProcessTimeout = time.Minute
+
+// credentials are the user and password of a credentials_file profile, or
+// the output of credential_process.
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// readCredentialsFile returns the credentials of profile in an INI or JSON
+// credentials file. JSON files map profile names to credentials.
+func readCredentialsFile(path, profile string) (*credentials, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading credentials_file: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading credentials_file: %v", err)
+	}
+
+	var profiles map[string]credentials
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := json.Unmarshal(data, &profiles); err != nil {
+			return nil, fmt.Errorf("Error parsing credentials_file %s as JSON: %v", path, err)
+		}
+	} else {
+		profiles, err = parseINICredentials(data)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing credentials_file %s as INI: %v", path, err)
+		}
+	}
+
+	profileCredentials, ok := profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("Profile %s not found in credentials_file %s", profile, path)
+	}
+	return &profileCredentials, nil
+}
+
+// parseINICredentials reads the username and password of every [profile]
+// section. Lines starting with # or ; are comments.
+func parseINICredentials(data []byte) (map[string]credentials, error) {
+	profiles := make(map[string]credentials)
+	profile := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			profile = strings.TrimSpace(line[1 : len(line)-1])
+			profiles[profile] = credentials{}
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+		if profile == "" {
+			return nil, fmt.Errorf("line %d: %s outside of a [profile]", lineNumber, strings.TrimSpace(parts[0]))
+		}
+
+		profileCredentials := profiles[profile]
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "username":
+			profileCredentials.Username = value
+		case "password":
+			profileCredentials.Password = value
+		}
+		profiles[profile] = profileCredentials
+	}
+	return profiles, scanner.Err()
+}
+
+// runCredentialProcess runs command with the shell and reads JSON
+// credentials from its output, e.g. {"username": "admin", "password": "..."}.
+func runCredentialProcess(command string) (*credentials, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialProcessTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	// The output holds the password, so it is neither logged nor part of
+	// the errors.
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Error running credential_process: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	processCredentials := new(credentials)
+	if err := json.Unmarshal(output, processCredentials); err != nil {
+		return nil, fmt.Errorf("Error parsing the output of credential_process as JSON: %v", err)
+	}
+	return processCredentials, nil
+}
+
+// loadCredentials fills in the user and password which were not configured
+// from credential_process, or from credentials_file.
+func (c *Config) loadCredentials() error {
+	if c.NSXUserName != "" && c.NSXPassword != "" {
+		return nil
+	}
+
+	var loaded *credentials
+	var err error
+	switch {
+	case c.CredentialProcess != "":
+		log.Printf("[DEBUG] Getting the NSX credentials from credential_process")
+		loaded, err = runCredentialProcess(c.CredentialProcess)
+	case c.CredentialsFile != "":
+		profile := c.Profile
+		if profile == "" {
+			profile = defaultCredentialsProfile
+		}
+		log.Printf("[DEBUG] Reading the NSX credentials of profile %s from %s", profile, c.CredentialsFile)
+		loaded, err = readCredentialsFile(c.CredentialsFile, profile)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.NSXUserName == "" {
+		c.NSXUserName = loaded.Username
+	}
+	if c.NSXPassword == "" {
+		c.NSXPassword = loaded.Password
+	}
+	return nil
+}
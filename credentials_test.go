@@ -0,0 +1,177 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testCredentialsINI = `# NSX credentials
+[default]
+username = admin
+password = s3cret
+
+[prod]
+; the vault agent rewrites this profile
+username=svc-terraform
+password = p=ss word
+`
+
+const testCredentialsJSON = `{
+  "default": {"username": "admin", "password": "s3cret"},
+  "prod": {"username": "svc-terraform", "password": "p=ss word"}
+}`
+
+func testCredentialsFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadCredentialsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nsx-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, path := range []string{
+		testCredentialsFile(t, dir, "credentials", testCredentialsINI),
+		testCredentialsFile(t, dir, "credentials.json", testCredentialsJSON),
+	} {
+		defaultCredentials, err := readCredentialsFile(path, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *defaultCredentials != (credentials{Username: "admin", Password: "s3cret"}) {
+			t.Errorf("%s: unexpected default credentials %+v", path, defaultCredentials)
+		}
+
+		prodCredentials, err := readCredentialsFile(path, "prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *prodCredentials != (credentials{Username: "svc-terraform", Password: "p=ss word"}) {
+			t.Errorf("%s: unexpected prod credentials %+v", path, prodCredentials)
+		}
+
+		if _, err := readCredentialsFile(path, "staging"); err == nil || !strings.Contains(err.Error(), "Profile staging not found") {
+			t.Errorf("%s: expected the missing profile to be reported, got %v", path, err)
+		}
+	}
+
+	testCases := map[string]string{
+		"username = admin\n":         "outside of a [profile]",
+		"[default]\nusername\n":      "line 2: expected key = value",
+		`{"default": {"username": }`: "as JSON",
+	}
+	for content, expected := range testCases {
+		path := testCredentialsFile(t, dir, "invalid", content)
+		if _, err := readCredentialsFile(path, "default"); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, expected, err)
+		}
+	}
+
+	if _, err := readCredentialsFile(filepath.Join(dir, "missing"), "default"); err == nil {
+		t.Error("expected a missing credentials_file to be reported")
+	}
+}
+
+func TestRunCredentialProcess(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need sh")
+	}
+
+	processCredentials, err := runCredentialProcess(`echo '{"username": "admin", "password": "s3cret"}'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *processCredentials != (credentials{Username: "admin", Password: "s3cret"}) {
+		t.Errorf("unexpected credentials %+v", processCredentials)
+	}
+
+	if _, err := runCredentialProcess("echo vault is sealed >&2; exit 2"); err == nil || !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("expected the failure of the command to be reported, got %v", err)
+	}
+
+	_, err = runCredentialProcess("echo username=admin password=s3cret")
+	if err == nil || !strings.Contains(err.Error(), "as JSON") {
+		t.Errorf("expected the output to be rejected, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("expected the output to be left out of the error, got %v", err)
+	}
+}
+
+func TestProviderConfigureCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands need sh")
+	}
+
+	dir, err := ioutil.TempDir("", "nsx-credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	credentialsFile := testCredentialsFile(t, dir, "credentials", testCredentialsINI)
+
+	testCases := []struct {
+		config   map[string]interface{}
+		user     string
+		password string
+		err      string
+	}{
+		{
+			config: map[string]interface{}{"credentials_file": credentialsFile},
+			user:   "admin", password: "s3cret",
+		},
+		{
+			config: map[string]interface{}{"credentials_file": credentialsFile, "profile": "prod"},
+			user:   "svc-terraform", password: "p=ss word",
+		},
+		{
+			config: map[string]interface{}{"credentials_file": credentialsFile, "nsxusername": "operator"},
+			user:   "operator", password: "s3cret",
+		},
+		{
+			config: map[string]interface{}{"credential_process": `printf '{"username": "vault", "password": "t0ken"}'`},
+			user:   "vault", password: "t0ken",
+		},
+		{
+			config: map[string]interface{}{"credential_process": `printf '{"username": "vault"}'`},
+			err:    "nsxpassword must be provided",
+		},
+		{
+			config: map[string]interface{}{"credentials_file": credentialsFile, "profile": "staging"},
+			err:    "Profile staging not found",
+		},
+	}
+
+	provider := Provider().(*schema.Provider)
+	for _, testCase := range testCases {
+		testCase.config["nsxserver"] = "nsx.example.test"
+		d := schema.TestResourceDataRaw(t, provider.Schema, testCase.config)
+
+		meta, err := providerConfigure(d)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected an error containing %q, got %v", testCase.config, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %v", testCase.config, err)
+		}
+
+		nsxclient := meta.(*NSXClient)
+		if nsxclient.User != testCase.user || nsxclient.Password != testCase.password {
+			t.Errorf("%v: expected %s/%s, got %s/%s", testCase.config, testCase.user, testCase.password, nsxclient.User, nsxclient.Password)
+		}
+	}
+}
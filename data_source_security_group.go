@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+)
+
+func dataSourceSecurityGroup() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceSecurityGroupRead,
+
+		Schema: map[string]*schema.Schema{
+			"scopeid": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"include_members": {
+				Type:     schema.TypeSet,
+				Computed: true,
+				Set:      schema.HashString,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"exclude_members": {
+				Type:     schema.TypeSet,
+				Computed: true,
+				Set:      schema.HashString,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"effective_vms":           schemaSecurityGroupEffectiveMembership(),
+			"effective_ip_addresses":  schemaSecurityGroupEffectiveMembership(),
+			"effective_mac_addresses": schemaSecurityGroupEffectiveMembership(),
+			"effective_vnics":         schemaSecurityGroupEffectiveMembership(),
+		},
+	}
+}
+
+func dataSourceSecurityGroupRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	scopeid := d.Get("scopeid").(string)
+	name := d.Get("name").(string)
+
+	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
+	securityGroupObject, err := getSingleSecurityGroup(scopeid, name, nsxclient)
+	if err != nil {
+		return err
+	}
+
+	id := securityGroupObject.ObjectID
+	if id == "" {
+		return fmt.Errorf("Security group %s not found in scope %s", name, scopeid)
+	}
+
+	securityGroup, err := getSecurityGroup(id, nsxclient)
+	if err != nil {
+		return err
+	}
+	if securityGroup == nil {
+		return fmt.Errorf("Security group %s not found", id)
+	}
+
+	d.SetId(id)
+	d.Set("include_members", flattenSecurityGroupMembers(securityGroup.Members))
+	d.Set("exclude_members", flattenSecurityGroupMembers(securityGroup.ExcludeMembers))
+
+	return readSecurityGroupEffectiveMembership(d, id, nsxclient)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+)
+
+func dataSourceSecurityPolicies() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceSecurityPoliciesRead,
+
+		Schema: map[string]*schema.Schema{
+			"policies": schemaSecurityPolicyList(),
+		},
+	}
+}
+
+func dataSourceSecurityPoliciesRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+
+	securityPolicies, err := getAllSecurityPolicies(nsxclient)
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Found %d security policies", len(securityPolicies))
+
+	d.SetId("securitypolicies")
+	return d.Set("policies", flattenSecurityPolicyList(sortSecurityPoliciesByPrecedence(securityPolicies)))
+}
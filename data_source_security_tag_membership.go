@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+	"sort"
+)
+
+func dataSourceSecurityTagVMs() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceSecurityTagVMsRead,
+
+		Schema: map[string]*schema.Schema{
+			"security_tag_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"vms": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"moid": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceSecurityTagVMsRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityTagID := d.Get("security_tag_id").(string)
+
+	virtualMachines, err := getSecurityTagVMs(securityTagID, nsxclient)
+	if isNotFoundError(err) {
+		return fmt.Errorf("Security tag %s not found", securityTagID)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("[DEBUG] Security tag %s is attached to %d VMs", securityTagID, len(virtualMachines))
+
+	sort.Slice(virtualMachines, func(i, j int) bool { return virtualMachines[i].ObjectID < virtualMachines[j].ObjectID })
+	vms := make([]map[string]interface{}, len(virtualMachines))
+	for i, vm := range virtualMachines {
+		vms[i] = map[string]interface{}{
+			"moid": vm.ObjectID,
+			"name": vm.Name,
+		}
+	}
+
+	d.SetId(securityTagID)
+	return d.Set("vms", vms)
+}
+
+func dataSourceVMSecurityTags() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceVMSecurityTagsRead,
+
+		Schema: map[string]*schema.Schema{
+			"moid": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"tags": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceVMSecurityTagsRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	moid := d.Get("moid").(string)
+
+	securityTagsAttached, err := getAllSecurityTagsAttached(moid, nsxclient)
+	if err != nil {
+		return err
+	}
+	securityTags := securityTagsAttached.SecurityTags
+	log.Printf("[DEBUG] %s has %d security tags", moid, len(securityTags))
+
+	sort.Slice(securityTags, func(i, j int) bool { return securityTags[i].ObjectID < securityTags[j].ObjectID })
+	tags := make([]map[string]interface{}, len(securityTags))
+	for i, securityTag := range securityTags {
+		tags[i] = map[string]interface{}{
+			"id":   securityTag.ObjectID,
+			"name": securityTag.Name,
+		}
+	}
+
+	d.SetId(moid)
+	return d.Set("tags", tags)
+}
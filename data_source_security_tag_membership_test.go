@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"reflect"
+	"testing"
+)
+
+func TestDataSourceSecurityTagMembership(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/securitytags/tag/securitytag-1/vm", "<basicinfolist><basicinfo><objectId>vm-2</objectId><name>db</name></basicinfo><basicinfo><objectId>vm-1</objectId><name>web-01</name></basicinfo></basicinfolist>")
+	server.respond("/api/2.0/services/securitytags/tag/securitytag-3/vm", "<basicinfolist></basicinfolist>")
+	server.respond("/api/2.0/services/securitytags/vm/vm-1", "<securityTags><securityTag><objectId>securitytag-2</objectId><name>quarantine</name></securityTag><securityTag><objectId>securitytag-1</objectId><name>web</name></securityTag></securityTags>")
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, dataSourceSecurityTagVMs().Schema, map[string]interface{}{"security_tag_id": "securitytag-1"})
+	if err := dataSourceSecurityTagVMsRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	expectedVMs := []interface{}{
+		map[string]interface{}{"moid": "vm-1", "name": "web-01"},
+		map[string]interface{}{"moid": "vm-2", "name": "db"},
+	}
+	if vms := d.Get("vms"); !reflect.DeepEqual(vms, expectedVMs) {
+		t.Fatalf("unexpected vms %v", vms)
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceSecurityTagVMs().Schema, map[string]interface{}{"security_tag_id": "securitytag-3"})
+	if err := dataSourceSecurityTagVMsRead(d, nsxclient); err != nil {
+		t.Fatalf("unexpected error for a security tag without VMs: %s", err)
+	}
+	if vms := d.Get("vms").([]interface{}); len(vms) != 0 {
+		t.Fatalf("unexpected vms %v", vms)
+	}
+	if d.Id() != "securitytag-3" {
+		t.Fatalf("unexpected ID %q", d.Id())
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceVMSecurityTags().Schema, map[string]interface{}{"moid": "vm-1"})
+	if err := dataSourceVMSecurityTagsRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	expectedTags := []interface{}{
+		map[string]interface{}{"id": "securitytag-1", "name": "web"},
+		map[string]interface{}{"id": "securitytag-2", "name": "quarantine"},
+	}
+	if tags := d.Get("tags"); !reflect.DeepEqual(tags, expectedTags) {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	d = schema.TestResourceDataRaw(t, dataSourceSecurityTagVMs().Schema, map[string]interface{}{"security_tag_id": "securitytag-9"})
+	if err := dataSourceSecurityTagVMsRead(d, nsxclient); err == nil {
+		t.Fatal("expected an error for a missing security tag")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// testNotFoundResponse is what NSX answers for objects which do not exist.
+const testNotFoundResponse = "<error><details>The requested object : %s could not be found. Object identifiers are case sensitive.</details><errorCode>202</errorCode><moduleName>core-services</moduleName></error>"
+
+// testNSXServer is a fake NSX Manager for unit tests. It answers GET requests
+// with the XML set by respond, passes requests to the handlers set by handle
+// and answers that everything else does not exist. Handlers run one at a
+// time, so they may change the state of the test without locking.
+type testNSXServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]string
+	handlers  map[string]http.HandlerFunc
+	requests  map[string]int
+
+	// notFoundStatus defaults to 404, some NSX APIs answer 400.
+	notFoundStatus int
+	// fallback, when set, answers the requests nothing else matches.
+	fallback http.HandlerFunc
+}
+
+func newTestNSXServer() *testNSXServer {
+	s := &testNSXServer{
+		responses: make(map[string]string),
+		handlers:  make(map[string]http.HandlerFunc),
+		requests:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// client returns an NSXClient for the server.
+func (s *testNSXServer) client() *NSXClient {
+	return NewNSXClient(s.URL, "user", "password", true, false)
+}
+
+// respond sets the answer to GET requests of path.
+func (s *testNSXServer) respond(path, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = response
+}
+
+// handle passes the requests of method and path to handler.
+func (s *testNSXServer) handle(method, path string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method+" "+path] = handler
+}
+
+// requested returns how many requests of method and path the server got.
+func (s *testNSXServer) requested(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+path]
+}
+
+func (s *testNSXServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.Method + " " + r.URL.Path
+	s.requests[key]++
+
+	if handler, ok := s.handlers[key]; ok {
+		handler(w, r)
+		return
+	}
+	if response, ok := s.responses[r.URL.Path]; ok && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, response)
+		return
+	}
+	if s.fallback != nil {
+		s.fallback(w, r)
+		return
+	}
+
+	notFoundStatus := s.notFoundStatus
+	if notFoundStatus == 0 {
+		notFoundStatus = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(notFoundStatus)
+	fmt.Fprintf(w, testNotFoundResponse, r.URL.Path)
+}
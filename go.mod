@@ -8,10 +8,11 @@ require (
 	github.com/hashicorp/go-uuid v1.0.1
 	github.com/hashicorp/hcl v0.0.0-20170509225359-392dba7d905e // indirect
 	github.com/hashicorp/terraform v0.12.7
+	github.com/mitchellh/go-homedir v1.1.0
 	github.com/sky-uk/gonsx v0.0.0-20180122153724-c3caef9aee9b
+	golang.org/x/net v0.0.0-20190502183928-7f726cade0ab
 )
 
 //replace github.com/sky-uk/gonsx => github.com/sgdigital-devops/gonsx v0.3.17-4
 //replace github.com/sky-uk/gonsx => github.com/orange-cloudfoundry/gonsx v0.4.1
 replace github.com/sky-uk/gonsx => github.com/seuf/gonsx v0.3.18-2
-
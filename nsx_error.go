@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/sky-uk/gonsx/api"
+	"strings"
+)
+
+// The kinds of NSXError, see NSXError.Kind.
+const (
+	nsxErrorNotFound   = "not found"
+	nsxErrorConflict   = "conflict"
+	nsxErrorValidation = "validation"
+	nsxErrorPermission = "permission"
+	nsxErrorUnknown    = "unknown"
+)
+
+// nsxErrorCodeObjectNotFound is the errorCode of "The requested object : X
+// could not be found", which NSX returns with 404 or 400 depending on the API.
+const nsxErrorCodeObjectNotFound = 202
+
+// nsxErrorCodeKinds classifies the errorCodes of the <error> bodies. NSX uses
+// the same status code, mostly 400, for very different errors, so the
+// errorCode decides whenever it is known.
+var nsxErrorCodeKinds = map[int]string{
+	nsxErrorCodeObjectNotFound: nsxErrorNotFound,
+	// The value of a field is not valid.
+	210: nsxErrorValidation,
+	// User is not authorized to make the call.
+	257: nsxErrorPermission,
+	// Object revision mismatch, it was changed since it was read.
+	301: nsxErrorConflict,
+}
+
+// nsxConflictDetails are found in the details of errors about an object
+// changed by someone else since it was read. They are only looked for when
+// the errorCode is not in nsxErrorCodeKinds.
+var nsxConflictDetails = []string{"older version", "revision", "concurrent"}
+
+// nsxErrorBody is the <error> body of failed NSX API calls.
+type nsxErrorBody struct {
+	XMLName    xml.Name `xml:"error"`
+	Details    string   `xml:"details"`
+	ErrorCode  int      `xml:"errorCode"`
+	ModuleName string   `xml:"moduleName"`
+}
+
+// NSXError is a failed NSX API call.
+type NSXError struct {
+	Method     string
+	Endpoint   string
+	StatusCode int
+	// ErrorCode, Details and ModuleName come from the <error> body, if any.
+	ErrorCode  int
+	Details    string
+	ModuleName string
+	// Body is the raw response, for errors which are not <error>.
+	Body string
+}
+
+// newNSXError returns the NSXError of a call.
+func newNSXError(api api.NSXApi) *NSXError {
+	nsxErr := &NSXError{
+		Method:     api.Method(),
+		Endpoint:   api.Endpoint(),
+		StatusCode: api.StatusCode(),
+		Body:       strings.TrimSpace(string(api.RawResponse())),
+	}
+
+	var body nsxErrorBody
+	if err := xml.Unmarshal(api.RawResponse(), &body); err == nil {
+		nsxErr.ErrorCode = body.ErrorCode
+		nsxErr.Details = strings.TrimSpace(body.Details)
+		nsxErr.ModuleName = body.ModuleName
+	}
+	return nsxErr
+}
+
+func (e *NSXError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s %s: status code %d, error code %d: %s", e.Method, e.Endpoint, e.StatusCode, e.ErrorCode, e.Details)
+	}
+	if e.Body != "" {
+		return fmt.Sprintf("%s %s: status code %d: %s", e.Method, e.Endpoint, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("%s %s: status code %d", e.Method, e.Endpoint, e.StatusCode)
+}
+
+// codeKind returns the kind of the errorCode, if it is in nsxErrorCodeKinds.
+func (e *NSXError) codeKind() (string, bool) {
+	kind, ok := nsxErrorCodeKinds[e.ErrorCode]
+	return kind, ok
+}
+
+// IsNotFound returns whether the object, or one it depends on, does not exist.
+func (e *NSXError) IsNotFound() bool {
+	if kind, ok := e.codeKind(); ok {
+		return kind == nsxErrorNotFound
+	}
+	return e.StatusCode == 404
+}
+
+// IsConflict returns whether the object was changed concurrently, or
+// conflicts with an existing one.
+func (e *NSXError) IsConflict() bool {
+	if kind, ok := e.codeKind(); ok {
+		return kind == nsxErrorConflict
+	}
+	if e.StatusCode == 409 || e.StatusCode == 412 {
+		return true
+	}
+	if e.StatusCode != 400 {
+		return false
+	}
+	details := strings.ToLower(e.Details + " " + e.Body)
+	for _, conflict := range nsxConflictDetails {
+		if strings.Contains(details, conflict) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPermission returns whether the credentials may not make the call.
+func (e *NSXError) IsPermission() bool {
+	if kind, ok := e.codeKind(); ok {
+		return kind == nsxErrorPermission
+	}
+	return e.StatusCode == 401 || e.StatusCode == 403
+}
+
+// IsValidation returns whether NSX rejected the request itself.
+func (e *NSXError) IsValidation() bool {
+	if kind, ok := e.codeKind(); ok {
+		return kind == nsxErrorValidation
+	}
+	return e.StatusCode == 400 && !e.IsNotFound() && !e.IsConflict()
+}
+
+// Kind names the class of the error.
+func (e *NSXError) Kind() string {
+	if kind, ok := e.codeKind(); ok {
+		return kind
+	}
+	switch {
+	case e.IsNotFound():
+		return nsxErrorNotFound
+	case e.IsConflict():
+		return nsxErrorConflict
+	case e.IsPermission():
+		return nsxErrorPermission
+	case e.IsValidation():
+		return nsxErrorValidation
+	}
+	return nsxErrorUnknown
+}
+
+// isNotFoundError returns whether err is an NSXError for a missing object.
+func isNotFoundError(err error) bool {
+	nsxErr, ok := err.(*NSXError)
+	return ok && nsxErr.IsNotFound()
+}
+
+// isConflictError returns whether err is an NSXError for a concurrent change.
+func isConflictError(err error) bool {
+	nsxErr, ok := err.(*NSXError)
+	return ok && nsxErr.IsConflict()
+}
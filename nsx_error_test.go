@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/sky-uk/gonsx/api"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNSXError(t *testing.T) {
+	testCases := []struct {
+		statusCode int
+		body       string
+		errorCode  int
+		kind       string
+		message    string
+	}{
+		{http.StatusNotFound, "", 0, "not found", "GET /api/2.0/test: status code 404"},
+		{http.StatusBadRequest, "<error><details>The requested object : ipset-7 could not be found. Object identifiers are case sensitive.</details><errorCode>202</errorCode><moduleName>core-services</moduleName></error>", 202, "not found", "GET /api/2.0/test: status code 400, error code 202: The requested object : ipset-7 could not be found. Object identifiers are case sensitive."},
+		{http.StatusConflict, "", 0, "conflict", "GET /api/2.0/test: status code 409"},
+		{http.StatusPreconditionFailed, "", 0, "conflict", "GET /api/2.0/test: status code 412"},
+		{http.StatusBadRequest, "<error><details>Object revision mismatch</details><errorCode>301</errorCode></error>", 301, "conflict", "GET /api/2.0/test: status code 400, error code 301: Object revision mismatch"},
+		{http.StatusBadRequest, "<error><details>Invalid precedence</details><errorCode>210</errorCode></error>", 210, "validation", "GET /api/2.0/test: status code 400, error code 210: Invalid precedence"},
+		{http.StatusForbidden, "<error><details>User is not authorized</details><errorCode>257</errorCode></error>", 257, "permission", "GET /api/2.0/test: status code 403, error code 257: User is not authorized"},
+		// The errorCode wins over the status code and the details.
+		{http.StatusBadRequest, "<error><details>Stale object</details><errorCode>301</errorCode></error>", 301, "conflict", "GET /api/2.0/test: status code 400, error code 301: Stale object"},
+		{http.StatusBadRequest, "<error><details>Invalid revision</details><errorCode>210</errorCode></error>", 210, "validation", "GET /api/2.0/test: status code 400, error code 210: Invalid revision"},
+		{http.StatusNotFound, "<error><details>Operation not permitted</details><errorCode>257</errorCode></error>", 257, "permission", "GET /api/2.0/test: status code 404, error code 257: Operation not permitted"},
+		{http.StatusBadRequest, "<error><details>Object has an older version</details><errorCode>999</errorCode></error>", 999, "conflict", "GET /api/2.0/test: status code 400, error code 999: Object has an older version"},
+		{http.StatusBadRequest, "<error><details>Name is too long</details><errorCode>999</errorCode></error>", 999, "validation", "GET /api/2.0/test: status code 400, error code 999: Name is too long"},
+		{http.StatusUnauthorized, "Unauthorized", 0, "permission", "GET /api/2.0/test: status code 401: Unauthorized"},
+		{http.StatusInternalServerError, "", 0, "unknown", "GET /api/2.0/test: status code 500"},
+	}
+
+	for _, testCase := range testCases {
+		server := newTestNSXServer()
+		server.handle(http.MethodGet, "/api/2.0/test", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(testCase.statusCode)
+			w.Write([]byte(testCase.body))
+		})
+		nsxclient := server.client()
+
+		testAPI := api.NewBaseAPI(http.MethodGet, "/api/2.0/test", nil, nil)
+		if err := nsxclient.Do(testAPI); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+
+		err := checkerr(testAPI)
+		nsxErr, ok := err.(*NSXError)
+		if !ok {
+			t.Fatalf("%d %s: expected an NSXError, got %#v", testCase.statusCode, testCase.body, err)
+		}
+		if nsxErr.ErrorCode != testCase.errorCode || nsxErr.Kind() != testCase.kind {
+			t.Errorf("%d %s: expected error code %d and kind %s, got %d and %s", testCase.statusCode, testCase.body, testCase.errorCode, testCase.kind, nsxErr.ErrorCode, nsxErr.Kind())
+		}
+		if nsxErr.Error() != testCase.message {
+			t.Errorf("%d %s: expected message %q, got %q", testCase.statusCode, testCase.body, testCase.message, nsxErr.Error())
+		}
+		if isNotFoundError(err) != (testCase.kind == "not found") || isConflictError(err) != (testCase.kind == "conflict") {
+			t.Errorf("%d %s: unexpected classification of %v", testCase.statusCode, testCase.body, err)
+		}
+	}
+
+	if isNotFoundError(nil) || isConflictError(errors.New("revision")) {
+		t.Error("expected errors other than NSXError not to be classified")
+	}
+}
+
+func TestResourceSecurityTagUpdateReturnsNSXError(t *testing.T) {
+	var revisions []int
+
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/securitytags/tag", "<securityTags><securityTag><objectId>securitytag-1</objectId><name>web</name><revision>3</revision></securityTag></securityTags>")
+	server.handle(http.MethodPut, "/api/2.0/services/securitytags/tag/securitytag-1", func(w http.ResponseWriter, r *http.Request) {
+		var securityTag SecurityTag
+		body, _ := ioutil.ReadAll(r.Body)
+		xml.Unmarshal(body, &securityTag)
+		revisions = append(revisions, securityTag.Revision)
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("<error><details>Security tag name web-servers is too long</details><errorCode>210</errorCode></error>"))
+	})
+	nsxclient := server.client()
+
+	r := resourceSecurityTag()
+	d, err := schema.InternalMap(r.Schema).Data(&terraform.InstanceState{
+		ID:         "securitytag-1",
+		Attributes: map[string]string{"name": "web", "desc": "Web"},
+	}, &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"name": {Old: "web", New: "web-servers"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = resourceSecurityTagUpdate(d, nsxclient)
+	nsxErr, ok := err.(*NSXError)
+	if !ok || !nsxErr.IsValidation() || !strings.Contains(nsxErr.Error(), "too long") {
+		t.Fatalf("expected a validation NSXError, got %#v", err)
+	}
+	if len(revisions) != 1 || revisions[0] != 3 {
+		t.Fatalf("expected the revision read to be sent back, got %v", revisions)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/mutexkv"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -11,7 +12,7 @@ import (
 // keys it takes, the resources it supports, a callback to configure, etc.
 func Provider() terraform.ResourceProvider {
 	// The actual provider
-	return &schema.Provider{
+	provider := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"debug": &schema.Schema{
 				Type:     schema.TypeBool,
@@ -31,13 +32,139 @@ func Provider() terraform.ResourceProvider {
 			"nsxpassword": &schema.Schema{
 				Type:        schema.TypeString,
 				Optional:    true,
+				Sensitive:   true,
 				DefaultFunc: schema.EnvDefaultFunc("NSXPASSWORD", nil),
 			},
+			"credentials_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("NSX_CREDENTIALS_FILE", nil),
+				ConflictsWith: []string{"credential_process"},
+				Description:   "INI or JSON file with the username and password of named profiles, used when nsxusername or nsxpassword is not set",
+			},
+			"profile": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_PROFILE", defaultCredentialsProfile),
+				Description: "Profile of credentials_file to use",
+			},
+			"credential_process": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_CREDENTIAL_PROCESS", nil),
+				Description: "Command printing the username and password as JSON, used when nsxusername or nsxpassword is not set",
+			},
 			"nsxserver": &schema.Schema{
 				Type:        schema.TypeString,
 				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("NSXSERVER", nil),
 			},
+			"nsxservers": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "NSX Managers to fail over to, in order, after nsxserver. The first healthy one is used",
+			},
+			"local_nsxserver": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_LOCAL_SERVER", nil),
+				Description: "NSX Manager for non universal objects, e.g. a secondary manager of a cross-vCenter deployment",
+			},
+			"read_only": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_READ_ONLY", false),
+				Description: "Refuse every request which would change NSX, so that plans can be run safely",
+			},
+			"audit_log_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_AUDIT_LOG_FILE", nil),
+				Description: "File to append a JSON line to for every NSX API call, with secrets redacted",
+			},
+			"token_auth": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_TOKEN_AUTH", false),
+				Description: "Obtain an API token at configure time and send it instead of nsxusername and nsxpassword",
+			},
+			"token_expiry_minutes": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("NSX_TOKEN_EXPIRY_MINUTES", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Lifetime of the API tokens, 0 means the NSX Manager default",
+			},
+			"ca_file": &schema.Schema{
+				Type:          schema.TypeString,
+				Optional:      true,
+				DefaultFunc:   schema.EnvDefaultFunc("NSX_CA_FILE", nil),
+				ConflictsWith: []string{"ca_pem"},
+				Description:   "PEM file with the CA certificates used to verify NSX Manager",
+			},
+			"ca_pem": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_CA_PEM", nil),
+				Description: "PEM encoded CA certificates used to verify NSX Manager",
+			},
+			"client_cert_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_CLIENT_CERT_FILE", nil),
+			},
+			"client_key_file": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_CLIENT_KEY_FILE", nil),
+			},
+			"tls_server_name": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_TLS_SERVER_NAME", nil),
+				Description: "Server name to verify the NSX Manager certificate against, instead of nsxserver",
+			},
+			"proxy_url": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_PROXY_URL", nil),
+				Description: "URL of the proxy to reach NSX Manager through, HTTPS_PROXY applies otherwise",
+			},
+			"no_proxy": &schema.Schema{
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("NSX_NO_PROXY", nil),
+				Description: "Comma separated hosts, domains and CIDRs which bypass proxy_url",
+			},
+			"request_timeout": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("NSX_REQUEST_TIMEOUT", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Timeout of a single NSX API request in seconds, 0 means no timeout",
+			},
+			"max_idle_conns": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      10,
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Number of idle connections kept open to NSX Manager",
+			},
+			"max_requests_per_second": &schema.Schema{
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("NSX_MAX_REQUESTS_PER_SECOND", 0),
+				ValidateFunc: validation.FloatBetween(0, 10000),
+				Description:  "Maximum rate of NSX API requests, 0 means no limit",
+			},
+			"max_concurrent_requests": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("NSX_MAX_CONCURRENT_REQUESTS", 0),
+				ValidateFunc: validation.IntAtLeast(0),
+				Description:  "Maximum number of NSX API requests in progress, and so of connections to NSX Manager, 0 means no limit",
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
@@ -51,35 +178,49 @@ func Provider() terraform.ResourceProvider {
 			"nsx_security_group":          resourceSecurityGroup(),
 			"nsx_security_tag":            resourceSecurityTag(),
 			"nsx_security_tag_attachment": resourceSecurityTagAttachment(),
+			"nsx_security_tag_vm":         resourceSecurityTagVM(),
 			"nsx_security_policy":         resourceSecurityPolicy(),
 			"nsx_security_policy_rule":    resourceSecurityPolicyRule(),
+			"nsx_security_policy_binding": resourceSecurityPolicyBinding(),
 			"nsx_firewall_exclusion":      resourceFirewallExclusion(),
 			"nsx_firewall_rule":           resourceFirewallRule(),
 			"nsx_nat_rule":                resourceNatRule(),
 		},
 
+		DataSourcesMap: map[string]*schema.Resource{
+			"nsx_security_group":    dataSourceSecurityGroup(),
+			"nsx_security_policies": dataSourceSecurityPolicies(),
+			"nsx_security_tag_vms":  dataSourceSecurityTagVMs(),
+			"nsx_vm_security_tags":  dataSourceVMSecurityTags(),
+		},
+
 		ConfigureFunc: providerConfigure,
 	}
+
+	// Attribute the calls in the audit log to the resources making them.
+	for name, resource := range provider.ResourcesMap {
+		auditResourceCalls(name, resource)
+	}
+	for name, dataSource := range provider.DataSourcesMap {
+		auditResourceCalls(name, dataSource)
+	}
+
+	return provider
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	debug := d.Get("debug").(bool)
 	insecure := d.Get("insecure").(bool)
 	nsxusername := d.Get("nsxusername").(string)
-
-	if nsxusername == "" {
-		return nil, fmt.Errorf("nsxusername must be provided")
-	}
-
 	nsxpassword := d.Get("nsxpassword").(string)
 
-	if nsxpassword == "" {
-		return nil, fmt.Errorf("nsxpassword must be provided")
-	}
-
 	nsxserver := d.Get("nsxserver").(string)
+	nsxservers, err := getListOfStrings(d, "nsxservers")
+	if err != nil {
+		return nil, err
+	}
 
-	if nsxserver == "" {
+	if nsxserver == "" && len(nsxservers) == 0 {
 		return nil, fmt.Errorf("nsxserver must be provided")
 	}
 
@@ -89,6 +230,45 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 		NSXUserName: nsxusername,
 		NSXPassword: nsxpassword,
 		NSXServer:   nsxserver,
+
+		CAFile:         d.Get("ca_file").(string),
+		CAPEM:          d.Get("ca_pem").(string),
+		ClientCertFile: d.Get("client_cert_file").(string),
+		ClientKeyFile:  d.Get("client_key_file").(string),
+		TLSServerName:  d.Get("tls_server_name").(string),
+
+		ProxyURL:       d.Get("proxy_url").(string),
+		NoProxy:        d.Get("no_proxy").(string),
+		RequestTimeout: d.Get("request_timeout").(int),
+		MaxIdleConns:   d.Get("max_idle_conns").(int),
+
+		MaxRequestsPerSecond:  d.Get("max_requests_per_second").(float64),
+		MaxConcurrentRequests: d.Get("max_concurrent_requests").(int),
+
+		NSXServers:     nsxservers,
+		LocalNSXServer: d.Get("local_nsxserver").(string),
+
+		ReadOnly:     d.Get("read_only").(bool),
+		AuditLogFile: d.Get("audit_log_file").(string),
+
+		TokenAuth:          d.Get("token_auth").(bool),
+		TokenExpiryMinutes: d.Get("token_expiry_minutes").(int),
+
+		CredentialsFile:   d.Get("credentials_file").(string),
+		Profile:           d.Get("profile").(string),
+		CredentialProcess: d.Get("credential_process").(string),
+	}
+
+	if err := config.loadCredentials(); err != nil {
+		return nil, err
+	}
+
+	if config.NSXUserName == "" {
+		return nil, fmt.Errorf("nsxusername must be provided, or come from credentials_file or credential_process")
+	}
+
+	if config.NSXPassword == "" {
+		return nil, fmt.Errorf("nsxpassword must be provided, or come from credentials_file or credential_process")
 	}
 
 	return config.Client()
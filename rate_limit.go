@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing rate requests per second, with
+// bursts of up to burst requests.
+type rateLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+	sleep    func(time.Duration)
+	disabled bool
+}
+
+// newRateLimiter returns a rateLimiter, or a disabled one when rate is 0.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		now:      time.Now,
+		sleep:    time.Sleep,
+		disabled: rate <= 0,
+	}
+}
+
+// reserve takes a token and returns how long the caller has to wait before
+// using it.
+func (r *rateLimiter) reserve() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	// Tokens may go negative, which queues the callers behind each other.
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.rate * float64(time.Second))
+}
+
+// Wait blocks until a request may be made and returns how long it waited.
+func (r *rateLimiter) Wait() time.Duration {
+	if r == nil || r.disabled {
+		return 0
+	}
+	wait := r.reserve()
+	if wait > 0 {
+		r.sleep(wait)
+	}
+	return wait
+}
+
+// semaphore limits the number of concurrent requests.
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore for n holders, or nil for no limit.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// Acquire blocks until the semaphore is free and returns how long it waited.
+func (s semaphore) Acquire() time.Duration {
+	if s == nil {
+		return 0
+	}
+	select {
+	case s <- struct{}{}:
+		return 0
+	default:
+	}
+	start := time.Now()
+	s <- struct{}{}
+	return time.Since(start)
+}
+
+// Release frees the semaphore.
+func (s semaphore) Release() {
+	if s != nil {
+		<-s
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	var waited []time.Duration
+
+	limiter := newRateLimiter(2, 2)
+	limiter.last = now
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) { waited = append(waited, d) }
+
+	// The burst is free, then the callers queue at 500ms intervals.
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, e := range expected {
+		if wait := limiter.Wait(); wait != e {
+			t.Fatalf("call %d: expected to wait %s, got %s", i, e, wait)
+		}
+	}
+	if len(waited) != 2 {
+		t.Fatalf("expected two sleeps, got %v", waited)
+	}
+
+	// Tokens refill over time, up to the burst.
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if wait := limiter.Wait(); wait != 0 {
+			t.Fatalf("expected a refilled token, waited %s", wait)
+		}
+	}
+	if wait := limiter.Wait(); wait != 500*time.Millisecond {
+		t.Fatalf("expected the burst to be capped, waited %s", wait)
+	}
+
+	if wait := newRateLimiter(0, 0).Wait(); wait != 0 {
+		t.Fatalf("expected a disabled limiter not to wait, got %s", wait)
+	}
+}
+
+func TestNSXClientConcurrentRequests(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	nsxclient := NewNSXClient(server.URL, "user", "password", true, false)
+	nsxclient.requests = newSemaphore(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := nsxclient.Do(NewGetAllVirtualMachines("globalroot-0")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most two requests in flight, got %d", maxInFlight)
+	}
+}
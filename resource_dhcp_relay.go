@@ -5,11 +5,10 @@ import (
 	"log"
 
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/dhcprelay"
 )
 
-func getAllDhcpRelays(edgeID string, nsxclient *gonsx.NSXClient) (*dhcprelay.DhcpRelay, error) {
+func getAllDhcpRelays(edgeID string, nsxclient *NSXClient) (*dhcprelay.DhcpRelay, error) {
 	//
 	// Get All DHCP Relay agents.
 	//
@@ -20,6 +19,9 @@ func getAllDhcpRelays(edgeID string, nsxclient *gonsx.NSXClient) (*dhcprelay.Dhc
 	if err != nil {
 		return nil, err
 	}
+	if err := checkerr(api); err != nil {
+		return nil, err
+	}
 
 	log.Println("Get All Response: ", api.GetResponse())
 	return api.GetResponse(), nil
@@ -87,7 +89,7 @@ func resourceDHCPRelay() *schema.Resource {
 }
 
 func resourceDHCPRelayCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var edgeid string
 	var agentList []dhcprelay.RelayAgent
 	var dhcpRelay dhcprelay.DhcpRelay
@@ -157,8 +159,8 @@ func resourceDHCPRelayCreate(d *schema.ResourceData, m interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if updateAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to update the DHCP relay %s", updateAPI.GetResponse())
+	} else if err := checkerr(updateAPI); err != nil {
+		return err
 	}
 
 	// If we get here, everything is OK.  Set the ID for the Terraform state
@@ -169,7 +171,7 @@ func resourceDHCPRelayCreate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceDHCPRelayRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var edgeid string
 	var agentList []dhcprelay.RelayAgent
 	// Gather the attributes for the resource.
@@ -181,7 +183,21 @@ func resourceDHCPRelayRead(d *schema.ResourceData, m interface{}) error {
 
 	DHCPRelay, err := getAllDhcpRelays(edgeid, nsxclient)
 	if err != nil {
-		return fmt.Errorf("Error: %v", err)
+		// The edge has been removed manually, and the relay with it.
+		if isNotFoundError(err) {
+			log.Printf(fmt.Sprintf("[DEBUG] Edge %s not found, state will be cleared", edgeid))
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
+
+	// Deleting the relay leaves an empty configuration behind.
+	relayServer := DHCPRelay.RelayServer
+	if len(relayServer.IPAddress) == 0 && len(relayServer.IPSets) == 0 && len(relayServer.DomainName) == 0 {
+		log.Printf(fmt.Sprintf("[DEBUG] DHCP relay of edge %s not found, state will be cleared", edgeid))
+		d.SetId("")
+		return nil
 	}
 
 	if len(DHCPRelay.RelayServer.IPSets) > 0 {
@@ -226,7 +242,7 @@ func resourceDHCPRelayRead(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceDHCPRelayUpdate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var agentList []dhcprelay.RelayAgent
 	var currentRelay *dhcprelay.DhcpRelay
 	var hasChanges bool
@@ -237,7 +253,7 @@ func resourceDHCPRelayUpdate(d *schema.ResourceData, m interface{}) error {
 
 	currentRelay, getAllErr := getAllDhcpRelays(d.Id(), nsxclient)
 	if getAllErr != nil {
-		return fmt.Errorf("Error: %v", getAllErr)
+		return getAllErr
 	}
 
 	if d.HasChange("ipsets") {
@@ -318,9 +334,8 @@ func resourceDHCPRelayUpdate(d *schema.ResourceData, m interface{}) error {
 		if err != nil {
 			return fmt.Errorf("Could not update the resource : %s", err)
 		}
-		if updateAPI.StatusCode() != 204 {
-			d.SetId("")
-			return fmt.Errorf("Error updating record : %s", updateAPI.GetResponse())
+		if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 		return resourceDHCPRelayRead(d, m)
 	}
@@ -330,7 +345,7 @@ func resourceDHCPRelayUpdate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceDHCPRelayDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var edgeid string
 
 	// Gather the attributes for the resource.
@@ -346,6 +361,9 @@ func resourceDHCPRelayDelete(d *schema.ResourceData, m interface{}) error {
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
 	}
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
+	}
 	log.Println("DHCP Relay agent deleted.")
 	d.SetId("")
 	return nil
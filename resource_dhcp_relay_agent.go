@@ -7,11 +7,10 @@ import (
 	"strings"
 
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/dhcprelay"
 )
 
-func getAllDhcpRelayAgents(edgeID string, nsxclient *gonsx.NSXClient) (*dhcprelay.DhcpRelay, error) {
+func getAllDhcpRelayAgents(edgeID string, nsxclient *NSXClient) (*dhcprelay.DhcpRelay, error) {
 	//
 	// Get All DHCP Relay agents.
 	//
@@ -22,6 +21,9 @@ func getAllDhcpRelayAgents(edgeID string, nsxclient *gonsx.NSXClient) (*dhcprela
 	if err != nil {
 		return nil, err
 	}
+	if err := checkerr(api); err != nil {
+		return nil, err
+	}
 
 	log.Println("Get Agents Response: ", api.GetResponse())
 	return api.GetResponse(), nil
@@ -66,7 +68,7 @@ func resourceDHCPRelayAgent() *schema.Resource {
 }
 
 func resourceDHCPRelayAgentCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	edgeid := d.Get("edgeid").(string)
 	vnicindex := d.Get("vnicindex").(string)
 
@@ -76,7 +78,10 @@ func resourceDHCPRelayAgentCreate(d *schema.ResourceData, m interface{}) error {
 	defer nsxMutexKV.Unlock(edgeid)
 
 	// Get existing Configuration
-	dhcpRelay, _ := getAllDhcpRelayAgents(edgeid, nsxclient)
+	dhcpRelay, err := getAllDhcpRelayAgents(edgeid, nsxclient)
+	if err != nil {
+		return err
+	}
 
 	// Check if already in list
 	for _, element := range dhcpRelay.RelayAgents {
@@ -95,12 +100,12 @@ func resourceDHCPRelayAgentCreate(d *schema.ResourceData, m interface{}) error {
 
 	// API Update
 	updateAPI := dhcprelay.NewUpdate(edgeid, *dhcpRelay)
-	err := nsxclient.Do(updateAPI)
+	err = nsxclient.Do(updateAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if updateAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to update the DHCP relay %s", updateAPI.GetResponse())
+	} else if err := checkerr(updateAPI); err != nil {
+		return err
 	}
 
 	d.SetId(id)
@@ -108,12 +113,20 @@ func resourceDHCPRelayAgentCreate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceDHCPRelayAgentRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 
 	s := strings.Split(d.Id(), ":")
 	edgeid, vnicindex := s[0], s[1]
 
-	dhcpRelay, _ := getAllDhcpRelayAgents(edgeid, nsxclient)
+	dhcpRelay, err := getAllDhcpRelayAgents(edgeid, nsxclient)
+	if err != nil {
+		// The edge has been removed manually, and the agent with it.
+		if isNotFoundError(err) {
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
 
 	for _, element := range dhcpRelay.RelayAgents {
 		if element.VnicIndex == vnicindex {
@@ -130,7 +143,7 @@ func resourceDHCPRelayAgentRead(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceDHCPRelayAgentDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 
 	s := strings.Split(d.Id(), ":")
 	edgeid, vnicindex := s[0], s[1]
@@ -139,7 +152,10 @@ func resourceDHCPRelayAgentDelete(d *schema.ResourceData, m interface{}) error {
 	defer nsxMutexKV.Unlock(edgeid)
 
 	// Get existing Configuration
-	dhcpRelay, _ := getAllDhcpRelayAgents(edgeid, nsxclient)
+	dhcpRelay, err := getAllDhcpRelayAgents(edgeid, nsxclient)
+	if err != nil {
+		return err
+	}
 
 	// Remove (if exists)
 	for i, element := range dhcpRelay.RelayAgents {
@@ -151,12 +167,12 @@ func resourceDHCPRelayAgentDelete(d *schema.ResourceData, m interface{}) error {
 
 	// Update
 	updateAPI := dhcprelay.NewUpdate(edgeid, *dhcpRelay)
-	err := nsxclient.Do(updateAPI)
+	err = nsxclient.Do(updateAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if updateAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to update the DHCP relay %s", updateAPI.GetResponse())
+	} else if err := checkerr(updateAPI); err != nil {
+		return err
 	}
 
 	d.SetId("")
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/dhcprelay"
 	"testing"
 )
@@ -112,7 +111,7 @@ func TestAccResourceDHCPRelayAgentGIAddressDefault(t *testing.T) {
 
 func testAccResourceDHCPRelayAgentExists(edgeid, vnicindex string, giaddress string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 		api := dhcprelay.NewGetAll(edgeid)
 		err := nsxClient.Do(api)
 		if err != nil {
@@ -131,7 +130,7 @@ func testAccResourceDHCPRelayAgentExists(edgeid, vnicindex string, giaddress str
 
 func testAccResourceDHCPRelayAgentDoesNotExists(edgeid, vnicindex string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 		api := dhcprelay.NewGetAll(edgeid)
 		err := nsxClient.Do(api)
 		if err != nil {
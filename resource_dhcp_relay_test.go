@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/dhcprelay"
 	"testing"
 )
@@ -36,7 +35,7 @@ func TestAccResourceDHCPRelay(t *testing.T) {
 }
 
 func testAccResourceDHCPRelayCheckDestroy(state *terraform.State) error {
-	nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+	nsxClient := testAccProvider.Meta().(*NSXClient)
 	for _, rs := range state.RootModule().Resources {
 		if rs.Type != "nsx_dhcp_relay" {
 			continue
@@ -72,7 +71,7 @@ func testAccResourceDHCPRelayExists(edgeid, resourcename string) resource.TestCh
 		if rs.Primary.ID == "" {
 			return fmt.Errorf("DHCPRelay resource ID not set")
 		}
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 		api := dhcprelay.NewGetAll(edgeid)
 		err := nsxClient.Do(api)
 		if err != nil {
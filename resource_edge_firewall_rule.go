@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/edgefirewall"
 	"log"
 	"strings"
@@ -121,11 +120,11 @@ func resourceEdgeFirewallRule() *schema.Resource {
 }
 
 func resourceEdgeFirewallRuleCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
 	edgeId := d.Get("edgeid").(string)
 	name := d.Get("name").(string)
-	r, err := getEdgeFirewallRuleByName(edgeId, name, meta)
+	r, err := getEdgeFirewallRuleByName(edgeId, name, nsxClientFor(d, meta))
 	if err != nil {
 		return err
 	}
@@ -150,7 +149,7 @@ func resourceEdgeFirewallRuleCreate(d *schema.ResourceData, meta interface{}) er
 	}
 
 	// Rule is created Fetch it's Id
-	r, err = getEdgeFirewallRuleByName(edgeId, name, meta)
+	r, err = getEdgeFirewallRuleByName(edgeId, name, nsxClientFor(d, meta))
 	if err != nil {
 		return err
 	}
@@ -163,12 +162,25 @@ func resourceEdgeFirewallRuleCreate(d *schema.ResourceData, meta interface{}) er
 func resourceEdgeFirewallRuleRead(d *schema.ResourceData, meta interface{}) error {
 	edgeId := d.Get("edgeid").(string)
 	name := d.Get("name").(string)
-	rule, err := getEdgeFirewallRuleByName(edgeId, name, meta)
+	rule, err := getEdgeFirewallRuleByName(edgeId, name, nsxClientFor(d, meta))
 	if err != nil {
+		// The edge has been removed manually, and the rule with it.
+		if isNotFoundError(err) {
+			log.Printf(fmt.Sprintf("[DEBUG] Edge %s not found, state will be cleared", edgeId))
+			d.SetId("")
+			return nil
+		}
 		return err
 	}
 	log.Printf(fmt.Sprintf("[DEBUG] resourceEdgeFirewallRuleRead RULE READ %+v", rule))
 
+	// If the resource has been removed manually, notify Terraform of this fact.
+	if rule.Name == "" {
+		log.Printf(fmt.Sprintf("[DEBUG] Rule %s not found on edge %s, state will be cleared", name, edgeId))
+		d.SetId("")
+		return nil
+	}
+
 	d.Set("name", rule.Name)
 	d.Set("rule_type", rule.RuleType)
 	d.Set("enabled", rule.Enabled)
@@ -204,11 +216,11 @@ func resourceEdgeFirewallRuleImport(d *schema.ResourceData, meta interface{}) ([
 }
 
 func resourceEdgeFirewallRuleUpdate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
 	edgeId := d.Get("edgeid").(string)
 	name := d.Get("name").(string)
-	rule, err := getEdgeFirewallRuleByName(edgeId, name, meta)
+	rule, err := getEdgeFirewallRuleByName(edgeId, name, nsxClientFor(d, meta))
 	if err != nil {
 		return err
 	}
@@ -227,25 +239,34 @@ func resourceEdgeFirewallRuleUpdate(d *schema.ResourceData, meta interface{}) er
 		return err
 	}
 
-	return nil
+	return checkerr(fRuleUpdate)
 }
 
 func resourceEdgeFirewallRuleDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
 	edgeId := d.Get("edgeid").(string)
 	name := d.Get("name").(string)
-	rule, err := getEdgeFirewallRuleByName(edgeId, name, meta)
-	if err != nil {
+	rule, err := getEdgeFirewallRuleByName(edgeId, name, nsxClientFor(d, meta))
+	if err != nil && !isNotFoundError(err) {
 		return err
 	}
 	log.Printf(fmt.Sprintf("[DEBUG] RULE READ %+v", rule))
 
+	// The rule, or the whole edge, is already gone.
+	if rule.Name == "" {
+		d.SetId("")
+		return nil
+	}
+
 	fRuleDelete := edgefirewall.NewDeleteRule(edgeId, rule.RuleId)
 	err = nsxclient.Do(fRuleDelete)
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fRuleDelete); err != nil && !isNotFoundError(err) {
+		return err
+	}
 	return nil
 }
 
@@ -303,14 +324,15 @@ func getRuleFromSchema(d *schema.ResourceData) (*edgefirewall.FirewallRule, erro
 	return &rule, nil
 }
 
-func getEdgeFirewallRuleByName(edgeId string, name string, meta interface{}) (edgefirewall.FirewallRule, error) {
-	nsxclient := meta.(*gonsx.NSXClient)
-
+func getEdgeFirewallRuleByName(edgeId string, name string, nsxclient *NSXClient) (edgefirewall.FirewallRule, error) {
 	fConfig := edgefirewall.NewGetEdgeFirewallConfig(edgeId)
 	err := nsxclient.Do(fConfig)
 	if err != nil {
 		return edgefirewall.FirewallRule{}, err
 	}
+	if err := checkerr(fConfig); err != nil {
+		return edgefirewall.FirewallRule{}, err
+	}
 	edgeFirewallConfig := fConfig.GetResponse()
 	for _, r := range edgeFirewallConfig.FirewallRules.FirewallRule {
 		if r.Name == name {
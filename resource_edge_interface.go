@@ -3,9 +3,8 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/edgeinterface"
-	"net/http"
+	"log"
 	"strconv"
 )
 
@@ -96,7 +95,7 @@ func ImportEdgeInterface(d *schema.ResourceData, meta interface{}) ([]*schema.Re
 }
 
 func resourceEdgeInterfaceCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 
 	var edge edgeinterface.EdgeInterface
 
@@ -132,10 +131,8 @@ func resourceEdgeInterfaceCreate(d *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
-	if createAPI.StatusCode() != http.StatusOK {
-		return fmt.Errorf("Failed to create edge interface, StatusCode:%d Response:%s",
-			createAPI.StatusCode(),
-			createAPI.RawResponse())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	edges := createAPI.GetResponse()
@@ -145,7 +142,7 @@ func resourceEdgeInterfaceCreate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceEdgeInterfaceRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 
 	edgeid := d.Get("edgeid").(string)
 	index := d.Get("index").(int)
@@ -153,13 +150,17 @@ func resourceEdgeInterfaceRead(d *schema.ResourceData, m interface{}) error {
 	api := edgeinterface.NewGet(edgeid, index)
 	err := nsxclient.Do(api)
 	if err != nil {
-		d.SetId("")
-		return nil
+		return err
 	}
 
-	if api.StatusCode() != http.StatusOK {
-		d.SetId("")
-		return fmt.Errorf("Error getting all interfaces: Status code: %d", api.StatusCode())
+	if err := checkerr(api); err != nil {
+		// The interface or the whole edge has been removed manually.
+		if isNotFoundError(err) {
+			log.Printf(fmt.Sprintf("[DEBUG] Interface %d not found on edge %s, state will be cleared", index, edgeid))
+			d.SetId("")
+			return nil
+		}
+		return err
 	}
 
 	edge := api.GetResponse()
@@ -187,7 +188,7 @@ func setEdge(d *schema.ResourceData, edge edgeinterface.EdgeInterface) {
 }
 
 func resourceEdgeInterfaceDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 
 	edgeid := d.Get("edgeid").(string)
 	if index, ok := d.GetOk("index"); ok {
@@ -198,18 +199,18 @@ func resourceEdgeInterfaceDelete(d *schema.ResourceData, m interface{}) error {
 		if err != nil {
 			return err
 		}
-		if deleteAPI.StatusCode() == http.StatusNoContent {
-			d.SetId("")
-			return nil
+		if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+			return err
 		}
-		return fmt.Errorf("Error deleting interface from NSX, Status code: %d", deleteAPI.StatusCode())
+		d.SetId("")
+		return nil
 	}
 	return fmt.Errorf("Error deleting resource %s, index not set", d.Get("Name").(string))
 }
 
 func resourceEdgeInterfaceUpdate(d *schema.ResourceData, m interface{}) error {
 
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	hasChanges := false
 
 	var updatedEdge edgeinterface.EdgeInterface
@@ -274,8 +275,8 @@ func resourceEdgeInterfaceUpdate(d *schema.ResourceData, m interface{}) error {
 			return err
 		}
 
-		if updateAPI.StatusCode() != http.StatusNoContent {
-			return fmt.Errorf("Error updating resource: status code: %d", updateAPI.StatusCode())
+		if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 	}
 
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/edgeinterface"
 	"net/http"
 	"strconv"
@@ -32,9 +31,7 @@ func TestAccResourceEdgeInterface(t *testing.T) {
 }
 
 func testAccResourceEdgeInterfaceCheckDestroy(state *terraform.State) error {
-	nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
-	// TODO  this seems not having effect on client behaviour...
-	nsxClient.IgnoreSSL = true
+	nsxClient := testAccProvider.Meta().(*NSXClient)
 
 	for _, rs := range state.RootModule().Resources {
 		if rs.Type != "nsx_edge_interface" {
@@ -78,8 +75,7 @@ func testAccResourceEdgeInterfaceExists(edgeid string, index int, name string) r
 			return fmt.Errorf("nsx_edge_interface resource ID not set")
 		}
 
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
-		nsxClient.IgnoreSSL = true
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		api := edgeinterface.NewGet(edgeid, index)
 		err := nsxClient.Do(api)
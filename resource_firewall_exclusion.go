@@ -3,12 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/firewallexclusion"
 	"log"
 )
 
-func getMember(moid string, nsxclient *gonsx.NSXClient) (*firewallexclusion.Member, error) {
+func getMember(moid string, nsxclient *NSXClient) (*firewallexclusion.Member, error) {
 	getAllAPI := firewallexclusion.NewGetAll()
 	err := nsxclient.Do(getAllAPI)
 
@@ -16,8 +15,8 @@ func getMember(moid string, nsxclient *gonsx.NSXClient) (*firewallexclusion.Memb
 		return nil, err
 	}
 
-	if getAllAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAPI.StatusCode(), getAllAPI.ResponseObject())
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
 	}
 
 	member := getAllAPI.GetResponse().FilterByMOID(moid)
@@ -46,7 +45,7 @@ func resourceFirewallExclusion() *schema.Resource {
 }
 
 func resourceFirewallExclusionCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var moid string
 
 	// Gather the attributes for the resource.
@@ -65,8 +64,8 @@ func resourceFirewallExclusionCreate(d *schema.ResourceData, meta interface{}) e
 		return fmt.Errorf("Error: %v", err)
 	}
 
-	if createAPI.StatusCode() != 200 {
-		return fmt.Errorf("%s", createAPI.ResponseObject())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	// If we get here, everything is OK.  Set the ID for the Terraform state
@@ -76,7 +75,7 @@ func resourceFirewallExclusionCreate(d *schema.ResourceData, meta interface{}) e
 }
 
 func resourceFirewallExclusionRead(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var moid string
 
 	// Gather the attributes for the resource.
@@ -103,7 +102,7 @@ func resourceFirewallExclusionRead(d *schema.ResourceData, meta interface{}) err
 }
 
 func resourceFirewallExclusionDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var moid string
 
 	// Gather the attributes for the resource.
@@ -127,14 +126,17 @@ func resourceFirewallExclusionDelete(d *schema.ResourceData, meta interface{}) e
 	// resources associated with the moid.
 	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByMOID(\"%s\").MOID", moid))
 	memberObject, err := getMember(moid, nsxclient)
-	id := memberObject.MOID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
+	if err != nil {
+		return err
+	}
 
 	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
+	if memberObject == nil {
 		d.SetId("")
 		return nil
 	}
+	id := memberObject.MOID
+	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
 
 	// If we got here, the resource exists, so we attempt to delete it.
 	deleteAPI := firewallexclusion.NewDelete(id)
@@ -144,6 +146,10 @@ func resourceFirewallExclusionDelete(d *schema.ResourceData, meta interface{}) e
 		return err
 	}
 
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
 	// If we got here, the resource had existed, we deleted it and there was
 	// no error.  Notify Terraform of this fact and return successful
 	// completion.
@@ -5,8 +5,8 @@ import (
 	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/firewall"
+	"log"
 	"strconv"
 )
 
@@ -60,6 +60,13 @@ func resourceFirewallRule() *schema.Resource {
 				Type:     schema.TypeInt,
 				Required: true,
 			},
+			"universal": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				ForceNew:    true,
+				Description: "Whether the rule lives in a universal section. Rules in universal sections can only reference universal objects",
+			},
 			"etag": {
 				Type:     schema.TypeString,
 				Computed: true,
@@ -202,6 +209,54 @@ func elementToSchemaRuleElement(elems []firewall.Element) []map[string]interface
 	return elemsMap
 }
 
+func getFirewallSection(sectionID int, nsxclient *NSXClient) (*FirewallSection, error) {
+	getAPI := NewGetFirewallSection(sectionID)
+	err := nsxclient.Do(getAPI)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkerr(getAPI); err != nil {
+		return nil, err
+	}
+	return getAPI.GetResponse(), nil
+}
+
+// validateFirewallRuleUniversal checks that the universal flag matches the
+// section the rule lives in and that rules in universal sections only
+// reference universal objects.
+func validateFirewallRuleUniversal(d *schema.ResourceData, nsxclient *NSXClient) error {
+	sectionID := d.Get("sectionid").(int)
+	section, err := getFirewallSection(sectionID, nsxclient)
+	if err != nil {
+		return err
+	}
+
+	universal := d.Get("universal").(bool)
+	if universal != (section.ManagedBy == universalScopeID) {
+		if universal {
+			return fmt.Errorf("firewall section %d is not a universal section", sectionID)
+		}
+		return fmt.Errorf("firewall section %d is a universal section, set universal = true", sectionID)
+	}
+
+	if !universal {
+		return nil
+	}
+
+	var ids []string
+	for _, key := range []string{"applied_to", "source", "source_excluded", "destination", "destination_excluded", "service"} {
+		for _, elem := range getListOfStructs(d.Get(key)) {
+			switch elem["type"].(string) {
+			case "Ipv4Address", "Ipv6Address", "DISTRIBUTED_FIREWALL":
+				continue
+			}
+			ids = append(ids, elem["value"].(string))
+		}
+	}
+	return validateUniversalReferences(ids, nsxclient)
+}
+
 func tfRuleToFirewallRule(d *schema.ResourceData) firewall.Rule {
 	id, err := strconv.Atoi(d.Id())
 	if err != nil {
@@ -295,13 +350,21 @@ func firewallRuleToTfRule(d *schema.ResourceData, rule *firewall.Rule) {
 }
 
 func resourceFirewallRuleCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
+
+	err := validateFirewallRuleUniversal(d, nsxclient)
+	if err != nil {
+		return err
+	}
 
 	fConfig := firewall.NewGetFirewallConfig()
-	err := nsxclient.Do(fConfig)
+	err = nsxclient.Do(fConfig)
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fConfig); err != nil {
+		return err
+	}
 	d.Set("etag", fConfig.ResponseHeaders().Get("Etag"))
 
 	rule := tfRuleToFirewallRule(d)
@@ -322,13 +385,18 @@ func resourceFirewallRuleCreate(d *schema.ResourceData, meta interface{}) error
 }
 
 func resourceFirewallRuleRead(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
-	fConfig := firewall.NewGetFirewallConfig()
+	// The configuration also tells whether the section of the rule is
+	// universal, so that no request per rule is needed for it.
+	fConfig := NewGetFirewallConfig()
 	err := nsxclient.Do(fConfig)
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fConfig); err != nil {
+		return err
+	}
 	d.Set("etag", fConfig.ResponseHeaders().Get("Etag"))
 	id, err := strconv.Atoi(d.Id())
 	if err != nil {
@@ -340,35 +408,56 @@ func resourceFirewallRuleRead(d *schema.ResourceData, meta interface{}) error {
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fRuleRead); err != nil {
+		// The rule or its whole section has been removed manually.
+		if isNotFoundError(err) {
+			log.Printf(fmt.Sprintf("[DEBUG] Firewall rule %d not found in section %d, state will be cleared", id, d.Get("sectionid").(int)))
+			d.SetId("")
+			return nil
+		}
+		return err
+	}
 	firewallRuleToTfRule(d, fRuleRead.GetResponse())
+
+	if section := fConfig.GetResponse().Layer3Section(d.Get("sectionid").(int)); section != nil {
+		d.Set("universal", section.ManagedBy == universalScopeID)
+	}
 	return nil
 }
 
 func resourceFirewallRuleUpdate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
 	id, err := strconv.Atoi(d.Id())
 	if err != nil {
 		return err
 	}
 
+	err = validateFirewallRuleUniversal(d, nsxclient)
+	if err != nil {
+		return err
+	}
+
 	rule := tfRuleToFirewallRule(d)
 	fRuleUpdate := firewall.NewUpdateRule(rule.SectionId, d.Get("etag").(string), id, rule)
 	err = nsxclient.Do(fRuleUpdate)
 	if err != nil {
 		return err
 	}
-	return nil
+	return checkerr(fRuleUpdate)
 }
 
 func resourceFirewallRuleDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 
 	fConfig := firewall.NewGetFirewallConfig()
 	err := nsxclient.Do(fConfig)
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fConfig); err != nil {
+		return err
+	}
 	etag := fConfig.ResponseHeaders().Get("Etag")
 
 	id, err := strconv.Atoi(d.Id())
@@ -381,5 +470,8 @@ func resourceFirewallRuleDelete(d *schema.ResourceData, meta interface{}) error
 	if err != nil {
 		return err
 	}
+	if err := checkerr(fRuleDelete); err != nil && !isNotFoundError(err) {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"testing"
+)
+
+const testFirewallRulePath = "/api/4.0/firewall/globalroot-0/config/layer3sections/1003/rules/1001"
+
+// testFirewallRuleServer answers the firewall configuration with etag and
+// records the If-Match header of the changes made to rule 1001.
+func testFirewallRuleServer(etag string, ifMatch map[string]string) *testNSXServer {
+	server := newTestNSXServer()
+	server.handle(http.MethodGet, "/api/4.0/firewall/globalroot-0/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Etag", etag)
+		w.Write([]byte(`<firewallConfiguration><layer3Sections><section id="1003" name="web"/></layer3Sections></firewallConfiguration>`))
+	})
+	server.respond("/api/4.0/firewall/globalroot-0/config/layer3sections/1003", `<section id="1003" name="web"/>`)
+	server.respond(testFirewallRulePath, `<rule id="1001"><name>web</name><action>allow</action><appliedToList><appliedTo><value>DISTRIBUTED_FIREWALL</value><type>DISTRIBUTED_FIREWALL</type></appliedTo></appliedToList><sectionId>1003</sectionId></rule>`)
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		method := method
+		server.handle(method, testFirewallRulePath, func(w http.ResponseWriter, r *http.Request) {
+			ifMatch[method] = r.Header.Get("If-Match")
+			if r.Header.Get("If-Match") != etag {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return server
+}
+
+func TestResourceFirewallRuleSendsEtag(t *testing.T) {
+	ifMatch := make(map[string]string)
+	server := testFirewallRuleServer(`"1554385324570"`, ifMatch)
+	defer server.Close()
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceFirewallRule().Schema, map[string]interface{}{
+		"name":      "web",
+		"sectionid": 1003,
+	})
+	d.SetId("1001")
+
+	if err := resourceFirewallRuleRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if etag := d.Get("etag").(string); etag != `"1554385324570"` {
+		t.Fatalf("expected the Etag of the firewall configuration to be read, got %q", etag)
+	}
+
+	if err := resourceFirewallRuleUpdate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if err := resourceFirewallRuleDelete(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		if ifMatch[method] != `"1554385324570"` {
+			t.Errorf("expected the %s to send If-Match with the Etag of the last GET, got %q", method, ifMatch[method])
+		}
+	}
+}
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"github.com/gregsteel/gonsx/api/ipset"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
+	"github.com/hashicorp/terraform/helper/validation"
 	"log"
+	"net"
+	"sort"
 	"strings"
 )
 
-func getSingleIPSet(scopeid, name string, nsxclient *gonsx.NSXClient) (*ipset.IPSet, error) {
+func getSingleIPSet(scopeid, name string, nsxclient *NSXClient) (*ipset.IPSet, error) {
 	getAllAPI := ipset.NewGetAll(scopeid)
 	err := nsxclient.Do(getAllAPI)
 
@@ -17,8 +19,8 @@ func getSingleIPSet(scopeid, name string, nsxclient *gonsx.NSXClient) (*ipset.IP
 		return nil, err
 	}
 
-	if getAllAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAPI.StatusCode(), getAllAPI.ResponseObject())
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
 	}
 
 	ipSet := getAllAPI.GetResponse().FilterByName(name)
@@ -48,25 +50,109 @@ func resourceIPSet() *schema.Resource {
 
 			"scopeid": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
 			},
 
+			"universal": schemaUniversal(),
+
 			"description": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
 			},
 
 			"value": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"values"},
+				Description:   "Comma separated list of addresses, use values instead",
+			},
+
+			"values": {
+				Type:          schema.TypeSet,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"value"},
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateNSXIPSetValue,
+				},
+				Set: hashIPSetValue,
+			},
+
+			"inheritance_allowed": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
 			},
 		},
 	}
 }
 
+// validateNSXIPSetValue accepts IPv4 and IPv6 addresses, ranges and networks,
+// like validateNSXIPAddress does for IPv4.
+func validateNSXIPSetValue(v interface{}, k string) ([]string, []error) {
+	parts := strings.Split(v.(string), "-")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	value := strings.Join(parts, "-")
+	return validation.Any(validation.SingleIP(), validation.IPRange(), validation.CIDRNetwork(0, 128))(value, k)
+}
+
+// normalizeIPSetValue returns the canonical form of an address, range or
+// network, so that equivalent notations don't show up as changes.
+func normalizeIPSetValue(value string) string {
+	value = strings.TrimSpace(value)
+
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String()
+	}
+
+	if _, ipnet, err := net.ParseCIDR(value); err == nil {
+		return ipnet.String()
+	}
+
+	if ips := strings.Split(value, "-"); len(ips) == 2 {
+		first, last := net.ParseIP(strings.TrimSpace(ips[0])), net.ParseIP(strings.TrimSpace(ips[1]))
+		if first != nil && last != nil {
+			return first.String() + "-" + last.String()
+		}
+	}
+
+	return value
+}
+
+func hashIPSetValue(v interface{}) int {
+	return schema.HashString(normalizeIPSetValue(v.(string)))
+}
+
+// joinIPSetValues returns the NSX value of an ipset, sorted so that the same
+// set of addresses always results in the same value.
+func joinIPSetValues(values *schema.Set) string {
+	normalized := make([]string, 0, values.Len())
+	for _, value := range values.List() {
+		normalized = append(normalized, normalizeIPSetValue(value.(string)))
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, ",")
+}
+
+// splitIPSetValue returns the addresses of an NSX ipset value.
+func splitIPSetValue(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = normalizeIPSetValue(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func resourceIPSetCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var name, scopeid, description, value string
 
 	// Gather the attributes for the resource.
@@ -76,93 +162,110 @@ func resourceIPSetCreate(d *schema.ResourceData, meta interface{}) error {
 		return fmt.Errorf("name argument is required")
 	}
 
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return fmt.Errorf("scopeid argument is required")
+	scopeid, err := resolveScopeID(d)
+	if err != nil {
+		return err
 	}
 
-	if v, ok := d.GetOk("description"); ok {
-		description = v.(string)
-	} else {
-		return fmt.Errorf("description argument is required")
-	}
+	description = d.Get("description").(string)
 
-	if v, ok := d.GetOk("value"); ok {
+	if v, ok := d.GetOk("values"); ok {
+		value = joinIPSetValues(v.(*schema.Set))
+	} else if v, ok := d.GetOk("value"); ok {
 		value = v.(string)
 	} else {
-		return fmt.Errorf("value argument is required")
+		return fmt.Errorf("one of value or values is required")
 	}
 
 	// Create the API, use it and check for errors.
-	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewCreate(%s, %s, %s, %s, %s)", scopeid, name, description, value))
-
-	ipSet := ipset.IPSet{Value: value, Name: name, Description: description}
+	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewCreate(%s, %s, %s, %s)", scopeid, name, description, value))
+
+	ipSet := ipset.IPSet{
+		Value:              value,
+		Name:               name,
+		Description:        description,
+		IsUniversal:        d.Get("universal").(bool),
+		InheritanceAllowed: d.Get("inheritance_allowed").(bool),
+	}
 	createAPI := ipset.NewCreate(scopeid, &ipSet)
-	err := nsxclient.Do(createAPI)
+	err = nsxclient.Do(createAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
 	}
 
-	if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("%s", createAPI.ResponseObject())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	// If we get here, everything is OK.  Set the ID for the Terraform state
 	// and return the response from the READ method.
 	d.SetId(createAPI.GetResponse())
+	d.Set("scopeid", scopeid)
 	return resourceIPSetRead(d, meta)
 }
 
-func resourceIPSetRead(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
-	var scopeid, name string
+func getIPSet(id string, nsxclient *NSXClient) (*ipset.IPSet, error) {
+	getAPI := ipset.NewGet(id)
+	err := nsxclient.Do(getAPI)
 
-	// Gather the attributes for the resource.
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return fmt.Errorf("scopeid argument is required")
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch ipset %s: %s", id, err)
 	}
 
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return fmt.Errorf("name argument is required")
+	if err := checkerr(getAPI); err != nil {
+		// Does not exist
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	// Gather all the resources that are associated with the specified
-	// scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewGetAll(%s)", scopeid))
-	api := ipset.NewGetAll(scopeid)
-	err := nsxclient.Do(api)
+	return getAPI.GetResponse(), nil
+}
+
+func resourceIPSetRead(d *schema.ResourceData, meta interface{}) error {
+	nsxclient := nsxClientFor(d, meta)
+	id := d.Id()
 
+	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewGet(%s)", id))
+	ipsetObject, err := getIPSet(id, nsxclient)
 	if err != nil {
 		return err
 	}
 
-	// See if we can find our specifically named resource within the list of
-	// resources associated with the scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	ipsetObject, err := getSingleIPSet(scopeid, name, nsxclient)
-	id := ipsetObject.ObjectID
-	d.SetId(id)
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
 	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
+	if ipsetObject == nil {
+		log.Printf(fmt.Sprintf("[DEBUG] ipset %s not found, state will be cleared", id))
 		d.SetId("")
+		return nil
 	}
 
+	d.Set("name", ipsetObject.Name)
+	d.Set("description", ipsetObject.Description)
+	d.Set("value", ipsetObject.Value)
+	d.Set("values", splitIPSetValue(ipsetObject.Value))
+	d.Set("universal", ipsetObject.IsUniversal)
+	d.Set("inheritance_allowed", ipsetObject.InheritanceAllowed)
 	return nil
 }
 
 func resourceIPSetImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
-	ipset_id := strings.Split(d.Id(), "_")
+	nsxclient := nsxClientFor(d, meta)
+	// Names may contain underscores, scope IDs never do.
+	ipset_id := strings.SplitN(d.Id(), "_", 2)
+	if len(ipset_id) != 2 {
+		return nil, fmt.Errorf("Invalid ipset import ID %s, expected <scope ID>_<name>", d.Id())
+	}
 	d.Set("scopeid", ipset_id[0])
-	d.Set("name", ipset_id[1])
-	err := resourceIPSetRead(d, meta)
+
+	ipsetObject, err := getSingleIPSet(ipset_id[0], ipset_id[1], nsxclient)
+	if err != nil {
+		return nil, err
+	}
+	d.SetId(ipsetObject.ObjectID)
+
+	err = resourceIPSetRead(d, meta)
 	if err != nil {
 		return nil, err
 	}
@@ -170,50 +273,18 @@ func resourceIPSetImport(d *schema.ResourceData, meta interface{}) ([]*schema.Re
 }
 
 func resourceIPSetDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
-	var name, scopeid string
-
-	// Gather the attributes for the resource.
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return fmt.Errorf("scopeid argument is required")
-	}
-
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return fmt.Errorf("name argument is required")
-	}
+	nsxclient := nsxClientFor(d, meta)
+	id := d.Id()
 
-	// Gather all the resources that are associated with the specified
-	// scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewGetAll(%s)", scopeid))
-	api := ipset.NewGetAll(scopeid)
-	err := nsxclient.Do(api)
+	deleteAPI := ipset.NewDelete(id)
+	err := nsxclient.Do(deleteAPI)
 
 	if err != nil {
 		return err
 	}
 
-	// See if we can find our specifically named resource within the list of
-	// resources associated with the scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	ipsetObject, err := getSingleIPSet(scopeid, name, nsxclient)
-	id := ipsetObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
-	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
-		d.SetId("")
-		return nil
-	}
-
-	// If we got here, the resource exists, so we attempt to delete it.
-	deleteAPI := ipset.NewDelete(id)
-	err = nsxclient.Do(deleteAPI)
-
-	if err != nil {
+	// The resource may have been removed manually already.
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
 		return err
 	}
 
@@ -227,42 +298,24 @@ func resourceIPSetDelete(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceIPSetUpdate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
-	var scopeid string
+	nsxclient := nsxClientFor(d, meta)
+	id := d.Id()
 	hasChanges := false
 
-	// Gather the attributes for the resource.
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return fmt.Errorf("scopeid argument is required")
-	}
-
-	// Do a GetAll on ipset resources that are associated with the specified scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] ipset.NewGetAll(%s)", scopeid))
-	api := ipset.NewGetAll(scopeid)
-	err := nsxclient.Do(api)
+	// Fetch the current version of the ipset, including its revision.
+	ipsetObject, err := getIPSet(id, nsxclient)
 	if err != nil {
-		log.Printf(fmt.Sprintf("[DEBUG] Error during getting all ipset resources: %s", err))
 		return err
 	}
 
-	// Find the resource with current name within all the scopeid resources.
-	oldName, newName := d.GetChange("name")
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", oldName.(string)))
-	ipsetObject, err := getSingleIPSet(scopeid, oldName.(string), nsxclient)
-	id := ipsetObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
-	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
-		d.SetId("")
-		log.Printf(fmt.Sprintf("[DEBUG] Could not find the ipset resource with %s name, state will be cleared", oldName))
-		return nil
+	// Only Read may clear the state of an ipset removed manually.
+	if ipsetObject == nil {
+		return fmt.Errorf("ipset %s no longer exists", id)
 	}
 
 	if d.HasChange("name") {
 		hasChanges = true
+		oldName, newName := d.GetChange("name")
 		ipsetObject.Name = newName.(string)
 		log.Printf(fmt.Sprintf("[DEBUG] Changing name of ipset from %s to %s", oldName.(string), newName.(string)))
 	}
@@ -274,21 +327,38 @@ func resourceIPSetUpdate(d *schema.ResourceData, meta interface{}) error {
 		log.Printf(fmt.Sprintf("[DEBUG] Changing description of ipset from %s to %s", oldDesc.(string), newDesc.(string)))
 	}
 
-	if d.HasChange("value") {
+	if d.HasChange("values") {
+		hasChanges = true
+		oldValue := ipsetObject.Value
+		ipsetObject.Value = joinIPSetValues(d.Get("values").(*schema.Set))
+		log.Printf(fmt.Sprintf("[DEBUG] Changing value of ipset from %s to %s", oldValue, ipsetObject.Value))
+	} else if d.HasChange("value") {
 		hasChanges = true
 		oldValue, newValue := d.GetChange("value")
 		ipsetObject.Value = newValue.(string)
 		log.Printf(fmt.Sprintf("[DEBUG] Changing value of ipset from %s to %s", oldValue.(string), newValue.(string)))
 	}
 
+	if d.HasChange("inheritance_allowed") {
+		hasChanges = true
+		ipsetObject.InheritanceAllowed = d.Get("inheritance_allowed").(bool)
+	}
+
 	if hasChanges {
-		updateAPI := ipset.NewUpdate(id, ipsetObject)
+		// NSX rejects the update if the revision we read is no longer current,
+		// rather than overwriting somebody else's change.
+		log.Printf(fmt.Sprintf("[DEBUG] Updating ipset %s at revision %d", id, ipsetObject.Revision))
+		updateAPI := NewUpdateIPSet(id, newIPSet(ipsetObject))
 		err = nsxclient.Do(updateAPI)
 
 		if err != nil {
 			log.Printf(fmt.Sprintf("[DEBUG] Error updating ipset resource: %s", err))
 			return err
 		}
+
+		if err := checkerr(updateAPI); err != nil {
+			return err
+		}
 	}
 	return resourceIPSetRead(d, meta)
 }
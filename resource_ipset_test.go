@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/gregsteel/gonsx/api/ipset"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateNSXIPSetValue(t *testing.T) {
+	valid := []string{"10.0.0.1", " 10.0.0.1 ", "10.0.0.0/24", "10.0.0.1-10.0.0.9", "10.0.0.1 - 10.0.0.9", "2001:db8::1", "2001:db8::/64", "2001:db8::1-2001:db8::9"}
+	for _, value := range valid {
+		if _, errs := validateNSXIPSetValue(value, "values"); len(errs) != 0 {
+			t.Errorf("expected %q to be valid, got %v", value, errs)
+		}
+	}
+
+	invalid := []string{"", "any", "10.0.0.1/24", "10.0.0.9-10.0.0.1", "10.0.0.256", "web.example.com"}
+	for _, value := range invalid {
+		if _, errs := validateNSXIPSetValue(value, "values"); len(errs) == 0 {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestNormalizeIPSetValue(t *testing.T) {
+	testCases := map[string]string{
+		" 10.0.0.1 ":                "10.0.0.1",
+		"2001:DB8:0:0::1":           "2001:db8::1",
+		"2001:DB8::/64":             "2001:db8::/64",
+		"10.0.0.1 - 10.0.0.9":       "10.0.0.1-10.0.0.9",
+		"2001:db8::1-2001:DB8::0:9": "2001:db8::1-2001:db8::9",
+	}
+
+	for value, expected := range testCases {
+		if actual := normalizeIPSetValue(value); actual != expected {
+			t.Errorf("normalizeIPSetValue(%q) = %q, expected %q", value, actual, expected)
+		}
+	}
+}
+
+func TestJoinIPSetValues(t *testing.T) {
+	values := schema.NewSet(hashIPSetValue, []interface{}{"10.0.1.0/24", " 10.0.0.1", "10.0.0.1", "2001:DB8::1"})
+	if values.Len() != 3 {
+		t.Fatalf("expected equivalent values to collapse, got %v", values.List())
+	}
+
+	expected := "10.0.0.1,10.0.1.0/24,2001:db8::1"
+	if actual := joinIPSetValues(values); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	if actual := splitIPSetValue(expected); !reflect.DeepEqual(actual, []string{"10.0.0.1", "10.0.1.0/24", "2001:db8::1"}) {
+		t.Fatalf("unexpected values %v", actual)
+	}
+}
+
+func TestResourceIPSetUpdateInPlace(t *testing.T) {
+	current := ipset.IPSet{ObjectID: "ipset-7", Revision: 3, Name: "web", Value: "10.0.0.1"}
+
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/ipset/ipset-7", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		body, _ := xml.Marshal(current)
+		w.Write(body)
+	})
+	server.handle(http.MethodPut, "/api/2.0/services/ipset/ipset-7", func(w http.ResponseWriter, r *http.Request) {
+		var update ipset.IPSet
+		body, _ := ioutil.ReadAll(r.Body)
+		xml.Unmarshal(body, &update)
+		if update.Revision != current.Revision {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		update.Revision++
+		current = update
+	})
+	nsxclient := server.client()
+
+	r := resourceIPSet()
+	state := &terraform.InstanceState{
+		ID: "ipset-7",
+		Attributes: map[string]string{
+			"name":     "web",
+			"scopeid":  "globalroot-0",
+			"values.#": "0",
+		},
+	}
+	d, err := schema.InternalMap(r.Schema).Data(state, &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"name":        {Old: "web", New: "web-servers"},
+			"description": {Old: "", New: "Web servers"},
+			"values.#":    {Old: "0", New: "2"},
+			fmt.Sprintf("values.%d", hashIPSetValue("10.0.0.2")): {New: "10.0.0.2"},
+			fmt.Sprintf("values.%d", hashIPSetValue("10.0.0.1")): {New: "10.0.0.1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resourceIPSetUpdate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "ipset-7" {
+		t.Fatalf("expected the ID to be kept, got %s", d.Id())
+	}
+	if current.Name != "web-servers" || current.Description != "Web servers" || current.Value != "10.0.0.1,10.0.0.2" || current.Revision != 4 {
+		t.Fatalf("unexpected ipset after update: %#v", current)
+	}
+}
+
+func TestResourceIPSetUpdateClearsDescription(t *testing.T) {
+	current := ipset.IPSet{ObjectID: "ipset-7", Revision: 3, Name: "web", Description: "Web servers", InheritanceAllowed: true, Value: "10.0.0.1"}
+
+	var sent string
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/ipset/ipset-7", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		body, _ := xml.Marshal(current)
+		w.Write(body)
+	})
+	server.handle(http.MethodPut, "/api/2.0/services/ipset/ipset-7", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		sent = string(body)
+	})
+	nsxclient := server.client()
+
+	r := resourceIPSet()
+	state := &terraform.InstanceState{
+		ID: "ipset-7",
+		Attributes: map[string]string{
+			"name":                "web",
+			"description":         "Web servers",
+			"scopeid":             "globalroot-0",
+			"value":               "10.0.0.1",
+			"inheritance_allowed": "true",
+		},
+	}
+	d, err := schema.InternalMap(r.Schema).Data(state, &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"description":         {Old: "Web servers", New: ""},
+			"inheritance_allowed": {Old: "true", New: "false"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resourceIPSetUpdate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range []string{"<description></description>", "<inheritanceAllowed>false</inheritanceAllowed>"} {
+		if !strings.Contains(sent, element) {
+			t.Fatalf("expected the update to contain %s, got %s", element, sent)
+		}
+	}
+}
+
+func TestResourceIPSetUpdateMissing(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceIPSet().Schema, map[string]interface{}{"name": "web", "value": "10.0.0.1"})
+	d.SetId("ipset-7")
+	if err := resourceIPSetUpdate(d, nsxclient); err == nil {
+		t.Fatal("expected an error for an ipset which no longer exists")
+	}
+	if d.Id() != "ipset-7" {
+		t.Fatalf("expected the ID to be kept, got %q", d.Id())
+	}
+}
+
+func TestResourceIPSetRead(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.fallback = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceIPSet().Schema, map[string]interface{}{"scopeid": "globalroot-0", "name": "web"})
+	d.SetId("ipset-1")
+	if err := resourceIPSetRead(d, nsxclient); err == nil || d.Id() != "ipset-1" {
+		t.Fatalf("expected the error to be returned and the ipset kept in state, got %v and ID %q", err, d.Id())
+	}
+
+	server.fallback = nil
+	if err := resourceIPSetRead(d, nsxclient); err != nil || d.Id() != "" {
+		t.Fatalf("expected the deleted ipset to be removed from state, got %v and ID %q", err, d.Id())
+	}
+}
+
+func TestResourceIPSetImport(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/ipset/scope/globalroot-0", "<list><ipset><objectId>ipset-2</objectId><name>web_servers</name></ipset></list>")
+	server.respond("/api/2.0/services/ipset/ipset-2", "<ipset><objectId>ipset-2</objectId><name>web_servers</name><value>10.0.0.1</value></ipset>")
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceIPSet().Schema, map[string]interface{}{})
+	d.SetId("globalroot-0_web_servers")
+	if _, err := resourceIPSetImport(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "ipset-2" || d.Get("name").(string) != "web_servers" {
+		t.Fatalf("expected ipset-2 named web_servers, got %s named %s", d.Id(), d.Get("name"))
+	}
+
+	d.SetId("web")
+	if _, err := resourceIPSetImport(d, nsxclient); err == nil {
+		t.Fatal("expected an import ID without scope to be rejected")
+	}
+}
@@ -3,10 +3,9 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/virtualwire"
-	"net/http"
 	"regexp"
+	"strings"
 )
 
 func resourceLogicalSwitch() *schema.Resource {
@@ -43,6 +42,13 @@ func resourceLogicalSwitch() *schema.Resource {
 				Required:    true,
 				Description: "The transport zone ID. Only required for creation.",
 			},
+			"universal": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				ForceNew:    true,
+				Description: "Whether the logical switch is universal. Universal logical switches must be created in a universal transport zone",
+			},
 			"labels": {
 				Type:        schema.TypeList,
 				Computed:    true,
@@ -64,7 +70,7 @@ func validateLogicalSwitchControlPlaneMode(v interface{}, k string) (ws []string
 
 func resourceLogicalSwitchCreate(d *schema.ResourceData, m interface{}) error {
 
-	nsxClient := m.(*gonsx.NSXClient)
+	nsxClient := nsxClientFor(d, m)
 	var scopeID string
 	var logicalSwitchCreate virtualwire.CreateSpec
 
@@ -94,16 +100,23 @@ func resourceLogicalSwitchCreate(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("Error logical switch create: scopeid attribute is required")
 	}
 
+	universal := d.Get("universal").(bool)
+	if universal != strings.HasPrefix(scopeID, universalTransportZonePrefix) {
+		if universal {
+			return fmt.Errorf("Error logical switch create: universal logical switches must be created in a universal transport zone, got %s", scopeID)
+		}
+		return fmt.Errorf("Error logical switch create: set universal = true to create a logical switch in universal transport zone %s", scopeID)
+	}
+
 	createAPI := virtualwire.NewCreate(logicalSwitchCreate, scopeID)
 	err := nsxClient.Do(createAPI)
 	if err != nil {
 		return fmt.Errorf("Error while creating logical switch %s: %v", logicalSwitchCreate.Name, err)
 	}
-	createResponseCode := createAPI.StatusCode()
-	createResponse := createAPI.GetResponse()
-	if createResponseCode != http.StatusCreated {
-		return fmt.Errorf("Error while creating logical switch %s. Invalid HTTP response code %d received. Response: %v", logicalSwitchCreate.Name, createResponseCode, createResponse)
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
+	createResponse := createAPI.GetResponse()
 
 	// NSX API returns the virtualwire ID as a string on successful creation and nothing else. E.g. virtualwire-101
 	d.SetId(createResponse)
@@ -112,7 +125,7 @@ func resourceLogicalSwitchCreate(d *schema.ResourceData, m interface{}) error {
 
 func resourceLogicalSwitchRead(d *schema.ResourceData, m interface{}) error {
 
-	nsxClient := m.(*gonsx.NSXClient)
+	nsxClient := nsxClientFor(d, m)
 	logicalSwitchID := d.Id()
 	if logicalSwitchID == "" {
 		return fmt.Errorf("Error obtaining logical switch ID from state during read")
@@ -123,9 +136,12 @@ func resourceLogicalSwitchRead(d *schema.ResourceData, m interface{}) error {
 	if err != nil {
 		return fmt.Errorf("Error while reading logical switch ID %s. Error: %v", logicalSwitchID, err)
 	}
-	if getAPI.StatusCode() == http.StatusNotFound {
-		d.SetId("")
-		return nil
+	if err := checkerr(getAPI); err != nil {
+		if isNotFoundError(err) {
+			d.SetId("")
+			return nil
+		}
+		return err
 	}
 
 	logicalSwitch := getAPI.GetResponse()
@@ -134,6 +150,7 @@ func resourceLogicalSwitchRead(d *schema.ResourceData, m interface{}) error {
 	d.Set("desc", logicalSwitch.Description)
 	d.Set("controlplanemode", logicalSwitch.ControlPlaneMode)
 	d.Set("tenantid", logicalSwitch.TenantID)
+	d.Set("universal", strings.HasPrefix(logicalSwitch.ObjectID, universalLogicalSwitchPrefix))
 
 	labelList := make([]string, 0)
 	for _, context := range logicalSwitch.VdsContext {
@@ -148,7 +165,7 @@ func resourceLogicalSwitchRead(d *schema.ResourceData, m interface{}) error {
 
 func resourceLogicalSwitchUpdate(d *schema.ResourceData, m interface{}) error {
 
-	nsxClient := m.(*gonsx.NSXClient)
+	nsxClient := nsxClientFor(d, m)
 	var updateVirtualWire virtualwire.VirtualWire
 	hasChanges := false
 	updateVirtualWire.ObjectID = d.Id()
@@ -198,9 +215,8 @@ func resourceLogicalSwitchUpdate(d *schema.ResourceData, m interface{}) error {
 		if err != nil {
 			return fmt.Errorf("Error while updating logical switch ID %s. Error %v", updateVirtualWire.ObjectID, err)
 		}
-		responseCode := updateLogicalSwitchAPI.StatusCode()
-		if responseCode != http.StatusOK {
-			return fmt.Errorf("Error while updating logical switch ID %s - invalid HTTP resposne code %d received", updateVirtualWire.ObjectID, responseCode)
+		if err := checkerr(updateLogicalSwitchAPI); err != nil {
+			return err
 		}
 		// NSX API doesn't return any content when change is successful. Setting values read in from the template.
 		d.SetId(updateVirtualWire.ObjectID)
@@ -213,7 +229,7 @@ func resourceLogicalSwitchUpdate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceLogicalSwitchDelete(d *schema.ResourceData, m interface{}) error {
-	nsxClient := m.(*gonsx.NSXClient)
+	nsxClient := nsxClientFor(d, m)
 	virtualWireID := d.Id()
 
 	if virtualWireID == "" {
@@ -226,9 +242,8 @@ func resourceLogicalSwitchDelete(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("Error while deleting logical switch ID %s. Error: %v", virtualWireID, err)
 	}
 
-	responseCode := deleteAPI.StatusCode()
-	if responseCode != http.StatusOK && responseCode != http.StatusNotFound {
-		return fmt.Errorf("Error while deleting logical switch ID %s. Received invalid HTTP response code %d", virtualWireID, responseCode)
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
 	}
 
 	d.SetId("")
@@ -5,7 +5,6 @@ import (
 	"github.com/hashicorp/terraform/helper/acctest"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/virtualwire"
 	"net/http"
 	"regexp"
@@ -85,7 +84,7 @@ func TestAccNSXLogicalSwitchBasic(t *testing.T) {
 func testAccNSXLogicalSwitchExists(name, resourceName string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
 
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		rs, ok := state.RootModule().Resources[resourceName]
 		if !ok {
@@ -117,7 +116,7 @@ func testAccNSXLogicalSwitchExists(name, resourceName string) resource.TestCheck
 
 func testAccNSXLogicalSwitchCheckDestroy(state *terraform.State, name string) error {
 
-	nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+	nsxClient := testAccProvider.Meta().(*NSXClient)
 
 	for _, rs := range state.RootModule().Resources {
 
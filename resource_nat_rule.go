@@ -10,7 +10,6 @@ import (
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/helper/validation"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/nat"
 
 	uuid "github.com/hashicorp/go-uuid"
@@ -165,7 +164,7 @@ func decomposeNatRuleId(ruleid string) (string, string) {
 	return s[0], s[1]
 }
 
-func getAllNatRules(nsxclient *gonsx.NSXClient, edgeID string) (*nat.Rules, error) {
+func getAllNatRules(nsxclient *NSXClient, edgeID string) (*nat.Rules, error) {
 	api := nat.NewGetAll(edgeID)
 	err := nsxclient.Do(api)
 
@@ -173,12 +172,16 @@ func getAllNatRules(nsxclient *gonsx.NSXClient, edgeID string) (*nat.Rules, erro
 		return nil, fmt.Errorf("Could not fetch NAT Rules: %s", err)
 	}
 
+	if err := checkerr(api); err != nil {
+		return nil, err
+	}
+
 	natconfig := api.GetResponse()
 
 	return &natconfig.Rules, nil
 }
 
-func getNatRule(nsxclient *gonsx.NSXClient, id string) (*nat.Rule, error) {
+func getNatRule(nsxclient *NSXClient, id string) (*nat.Rule, error) {
 	edgeid, ruleid := decomposeNatRuleId(id)
 	natrules, err := getAllNatRules(nsxclient, edgeid)
 	if err != nil {
@@ -268,7 +271,7 @@ func expandNatRule(d *schema.ResourceData, rule *nat.Rule) error {
 }
 
 func resourceNatRuleCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	edgeid := d.Get("edgeid").(string)
 
 	rule_uuid, uuid_err := uuid.GenerateUUID()
@@ -292,14 +295,14 @@ func resourceNatRuleCreate(d *schema.ResourceData, m interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("Failed to create DNAT rule: %s", createAPI.GetResponse())
+	} else if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	// Read Back
 	rules, err := getAllNatRules(nsxclient, edgeid)
 	if err != nil {
-		return fmt.Errorf("Could not fetch NAT Rules: %s", err)
+		return err
 	}
 
 	var ruleid string = ""
@@ -328,24 +331,25 @@ func resourceNatRuleCreate(d *schema.ResourceData, m interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if updateAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to update NAT rule: %s", updateAPI.GetResponse())
+	} else if err := checkerr(updateAPI); err != nil {
+		return err
 	}
 
 	return resourceNatRuleRead(d, m)
 }
 
 func resourceNatRuleRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var id = d.Id()
 	log.Printf(fmt.Sprintf("[DEBUG] Reading NATID: |%s|", id))
 
 	// Read Back
 	rule, err := getNatRule(nsxclient, id)
-	if err != nil {
+	if err != nil && !isNotFoundError(err) {
 		return err
 	}
 
+	// The rule, or the whole edge, has been removed manually.
 	if rule == nil {
 		d.SetId("")
 		return nil
@@ -380,7 +384,7 @@ func resourceNatRuleRead(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceNatRuleUpdate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var id = d.Id()
 	edgeid, ruleid := decomposeNatRuleId(id)
 
@@ -397,15 +401,15 @@ func resourceNatRuleUpdate(d *schema.ResourceData, m interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if updateAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to update NAT rule: %s", updateAPI.GetResponse())
+	} else if err := checkerr(updateAPI); err != nil {
+		return err
 	}
 
 	return resourceNatRuleRead(d, m)
 }
 
 func resourceNatRuleDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var id = d.Id()
 	edgeid, ruleid := decomposeNatRuleId(id)
 
@@ -417,8 +421,8 @@ func resourceNatRuleDelete(d *schema.ResourceData, m interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if deleteAPI.StatusCode() != 204 {
-		return fmt.Errorf("Failed to delete %s", id)
+	} else if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
 	}
 
 	d.SetId("")
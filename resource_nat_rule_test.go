@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/nat"
 	"regexp"
 	"testing"
@@ -244,7 +243,7 @@ func TestAccResourceSNatRule(t *testing.T) {
 }
 
 func testAccResourceNatRulesAreEmpty(edgeid string) error {
-	nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+	nsxClient := testAccProvider.Meta().(*NSXClient)
 
 	api := nat.NewGetAll(edgeid)
 	err := nsxClient.Do(api)
@@ -263,7 +262,7 @@ func testAccResourceNatRulesAreEmpty(edgeid string) error {
 
 func testAccNatRuleWithDescriptionExists(edgeid string, description string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		api := nat.NewGetAll(edgeid)
 		err := nsxClient.Do(api)
@@ -285,7 +284,7 @@ func testAccNatRuleWithDescriptionExists(edgeid string, description string) reso
 
 func testAccNatRuleWithDescriptionNotExists(edgeid string, description string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		api := nat.NewGetAll(edgeid)
 		err := nsxClient.Do(api)
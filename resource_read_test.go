@@ -0,0 +1,175 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"net/http"
+	"testing"
+)
+
+type testReadCase struct {
+	resource   string
+	id         string
+	attributes map[string]string
+	// responses are the GET responses by path, everything else is not found.
+	responses map[string]string
+	// notFoundStatus defaults to 404, some NSX APIs answer 400.
+	notFoundStatus int
+}
+
+var testReadCases = []testReadCase{
+	{resource: "nsx_logical_switch", id: "virtualwire-1", attributes: map[string]string{"name": "web"}},
+	{resource: "nsx_edge_interface", id: "edge-1_1", attributes: map[string]string{"edgeid": "edge-1", "index": "1"}},
+	// The edge is gone.
+	{resource: "nsx_edge_firewall_rule", id: "edge-1_web", attributes: map[string]string{"edgeid": "edge-1", "name": "web"}},
+	// The rule is gone.
+	{
+		resource:   "nsx_edge_firewall_rule",
+		id:         "edge-1_web",
+		attributes: map[string]string{"edgeid": "edge-1", "name": "web"},
+		responses: map[string]string{
+			"/api/4.0/edges/edge-1/firewall/config": "<firewall><firewallRules><firewallRule><id>1</id><name>ssh</name></firewallRule></firewallRules></firewall>",
+		},
+	},
+	// The edge is gone.
+	{resource: "nsx_dhcp_relay", id: "edge-1", attributes: map[string]string{"edgeid": "edge-1"}},
+	// The relay is gone.
+	{
+		resource:   "nsx_dhcp_relay",
+		id:         "edge-1",
+		attributes: map[string]string{"edgeid": "edge-1"},
+		responses:  map[string]string{"/api/4.0/edges/edge-1/dhcp/config/relay": "<relay></relay>"},
+	},
+	{resource: "nsx_dhcp_relay_agent", id: "edge-1:0", attributes: map[string]string{"edgeid": "edge-1", "vnicindex": "0"}},
+	{resource: "nsx_ip_set", id: "ipset-1", attributes: map[string]string{"name": "web"}, notFoundStatus: http.StatusBadRequest},
+	{resource: "nsx_service", id: "application-1", attributes: map[string]string{"name": "web"}},
+	{resource: "nsx_security_group", id: "securitygroup-1", attributes: map[string]string{"name": "web"}},
+	{
+		resource:   "nsx_security_tag",
+		id:         "securitytag-1",
+		attributes: map[string]string{"name": "web"},
+		responses:  map[string]string{"/api/2.0/services/securitytags/tag": "<securityTags><securityTag><objectId>securitytag-2</objectId><name>db</name></securityTag></securityTags>"},
+	},
+	// The VM is gone.
+	{
+		resource:       "nsx_security_tag_attachment",
+		id:             "vm-1",
+		attributes:     map[string]string{"moid": "vm-1", "tagid.#": "1", "tagid.0": "securitytag-1"},
+		notFoundStatus: http.StatusBadRequest,
+	},
+	// Every tag has been detached.
+	{
+		resource:   "nsx_security_tag_attachment",
+		id:         "vm-1",
+		attributes: map[string]string{"moid": "vm-1", "tagid.#": "1", "tagid.0": "securitytag-1"},
+		responses:  map[string]string{"/api/2.0/services/securitytags/vm/vm-1": "<securityTags></securityTags>"},
+	},
+	{resource: "nsx_security_tag_vm", id: "securitytag-1:vm-1", attributes: map[string]string{"security_tag_id": "securitytag-1", "moid": "vm-1"}},
+	{
+		resource:   "nsx_security_policy",
+		id:         "policy-1",
+		attributes: map[string]string{"name": "web"},
+		responses:  map[string]string{"/api/2.0/services/policy/securitypolicy/all": "<securityPolicies></securityPolicies>"},
+	},
+	// The policy is gone.
+	{
+		resource:   "nsx_security_policy_rule",
+		id:         "action-1",
+		attributes: map[string]string{"name": "allow", "securitypolicyname": "web"},
+		responses:  map[string]string{"/api/2.0/services/policy/securitypolicy/all": "<securityPolicies></securityPolicies>"},
+	},
+	// The policy is gone.
+	{resource: "nsx_security_policy_binding", id: "policy-1:securitygroup-1", attributes: map[string]string{"security_policy_id": "policy-1", "security_group_id": "securitygroup-1"}},
+	{
+		resource:   "nsx_firewall_exclusion",
+		id:         "vm-1",
+		attributes: map[string]string{"moid": "vm-1"},
+		responses:  map[string]string{"/api/2.1/app/excludelist": "<VshieldAppConfiguration></VshieldAppConfiguration>"},
+	},
+	// The rule, or its section, is gone.
+	{
+		resource:   "nsx_firewall_rule",
+		id:         "1001",
+		attributes: map[string]string{"sectionid": "1002"},
+		responses:  map[string]string{"/api/4.0/firewall/globalroot-0/config": "<firewallConfiguration></firewallConfiguration>"},
+	},
+	// The edge is gone.
+	{resource: "nsx_nat_rule", id: "edge-1:196609", attributes: map[string]string{"edgeid": "edge-1"}},
+	// The rule is gone.
+	{
+		resource:   "nsx_nat_rule",
+		id:         "edge-1:196609",
+		attributes: map[string]string{"edgeid": "edge-1"},
+		responses:  map[string]string{"/api/4.0/edges/edge-1/nat/config": "<nat><natRules><natRule><ruleId>196610</ruleId></natRule></natRules></nat>"},
+	},
+}
+
+func testReadResourceData(t *testing.T, testCase testReadCase) (*schema.Resource, *schema.ResourceData) {
+	r := Provider().(*schema.Provider).ResourcesMap[testCase.resource]
+	d, err := schema.InternalMap(r.Schema).Data(&terraform.InstanceState{ID: testCase.id, Attributes: testCase.attributes}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, d
+}
+
+func TestResourceReadRemovesDeletedResources(t *testing.T) {
+	for _, testCase := range testReadCases {
+		server := newTestNSXServer()
+		server.notFoundStatus = testCase.notFoundStatus
+		for path, response := range testCase.responses {
+			server.respond(path, response)
+		}
+		nsxclient := server.client()
+
+		r, d := testReadResourceData(t, testCase)
+		if err := r.Read(d, nsxclient); err != nil {
+			t.Errorf("%s %s: expected the deleted resource to be removed from state, got %v", testCase.resource, testCase.id, err)
+		} else if d.Id() != "" {
+			t.Errorf("%s %s: expected the deleted resource to be removed from state, still have ID %s", testCase.resource, testCase.id, d.Id())
+		}
+		server.Close()
+	}
+}
+
+func TestResourceReadKeepsStateOnErrors(t *testing.T) {
+	server := newTestNSXServer()
+	server.fallback = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	defer server.Close()
+	nsxclient := server.client()
+
+	for _, testCase := range testReadCases {
+		r, d := testReadResourceData(t, testCase)
+		if err := r.Read(d, nsxclient); err == nil {
+			t.Errorf("%s %s: expected the error of NSX to be returned", testCase.resource, testCase.id)
+		}
+		if d.Id() != testCase.id {
+			t.Errorf("%s %s: expected the resource to stay in state, got ID %q", testCase.resource, testCase.id, d.Id())
+		}
+	}
+}
+
+func TestResourceSecurityTagAttachmentReadSetsAttachedTags(t *testing.T) {
+	server := newTestNSXServer()
+	server.respond("/api/2.0/services/securitytags/vm/vm-1", "<securityTags><securityTag><objectId>securitytag-3</objectId></securityTag><securityTag><objectId>securitytag-1</objectId></securityTag></securityTags>")
+	defer server.Close()
+	nsxclient := server.client()
+
+	r, d := testReadResourceData(t, testReadCase{
+		resource:   "nsx_security_tag_attachment",
+		id:         "vm-1",
+		attributes: map[string]string{"moid": "vm-1", "tagid.#": "2", "tagid.0": "securitytag-1", "tagid.1": "securitytag-2"},
+	})
+	if err := r.Read(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "vm-1" {
+		t.Fatalf("expected the attachment to stay in state, got ID %q", d.Id())
+	}
+	tagIDs := d.Get("tagid").([]interface{})
+	if len(tagIDs) != 2 || tagIDs[0] != "securitytag-1" || tagIDs[1] != "securitytag-3" {
+		t.Fatalf("expected the attached tags, those in state first, got %v", tagIDs)
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/securitygroup"
 	"log"
+	"strings"
 )
 
-func getSingleSecurityGroup(scopeID, name string, nsxclient *gonsx.NSXClient) (*securitygroup.SecurityGroup, error) {
+func getSingleSecurityGroup(scopeID, name string, nsxclient *NSXClient) (*securitygroup.SecurityGroup, error) {
 	getAllAPI := securitygroup.NewGetAll(scopeID)
 	err := nsxclient.Do(getAllAPI)
 
@@ -17,8 +17,8 @@ func getSingleSecurityGroup(scopeID, name string, nsxclient *gonsx.NSXClient) (*
 		return nil, err
 	}
 
-	if getAllAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAPI.StatusCode(), getAllAPI.ResponseObject())
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
 	}
 
 	securityGroup := getAllAPI.GetResponse().FilterByName(name)
@@ -31,20 +31,55 @@ func resourceSecurityGroup() *schema.Resource {
 		Read:   resourceSecurityGroupRead,
 		Update: resourceSecurityGroupUpdate,
 		Delete: resourceSecurityGroupDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
 
 		Schema: map[string]*schema.Schema{
 			"scopeid": &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
 			},
+			"universal": schemaUniversal(),
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
 				Required: true,
 			},
+			"include_members": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Set:      schema.HashString,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateSecurityGroupMember,
+				},
+			},
+			"exclude_members": &schema.Schema{
+				Type:     schema.TypeSet,
+				Optional: true,
+				Set:      schema.HashString,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateSecurityGroupMember,
+				},
+			},
+			// Resolving the effective membership takes four more requests
+			// on every refresh, which large configurations may opt out of.
+			"read_effective_membership": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Read the effective_* attributes on refresh",
+			},
+			"effective_vms":           schemaSecurityGroupEffectiveMembership(),
+			"effective_ip_addresses":  schemaSecurityGroupEffectiveMembership(),
+			"effective_mac_addresses": schemaSecurityGroupEffectiveMembership(),
+			"effective_vnics":         schemaSecurityGroupEffectiveMembership(),
 			"dynamic_membership": &schema.Schema{
 				Type:     schema.TypeList,
-				Required: true,
+				Optional: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"set_operator": &schema.Schema{
@@ -86,6 +121,35 @@ func resourceSecurityGroup() *schema.Resource {
 	}
 }
 
+func schemaSecurityGroupEffectiveMembership() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Computed: true,
+		Set:      schema.HashString,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+	}
+}
+
+func validateSecurityGroupMember(v interface{}, k string) (ws []string, errors []error) {
+	value := v.(string)
+	memberPrefixes := []string{
+		"vm-",
+		"ipset-",
+		"macset-",
+		"virtualwire-",
+		universalLogicalSwitchPrefix,
+		"securitygroup-",
+		"securitytag-",
+	}
+	for _, prefix := range memberPrefixes {
+		if strings.HasPrefix(value, prefix) && len(value) > len(prefix) {
+			return
+		}
+	}
+	errors = append(errors, fmt.Errorf("%q must be the object ID of a VM, IP set, MAC set, logical switch, security group or security tag, got %q", k, value))
+	return
+}
+
 func validateSecurityGroupSetOperator(v interface{}, k string) (ws []string, errors []error) {
 	value := v.(string)
 	if value != "OR" && value != "AND" {
@@ -165,47 +229,158 @@ func buildDynamicRules(m interface{}, rulesOperator string) ([]securitygroup.Dyn
 	return newDynamicCriterion, nil
 }
 
+func buildSecurityGroupMembers(m interface{}) []SecurityGroupMember {
+	memberIDs := m.(*schema.Set).List()
+	members := make([]SecurityGroupMember, len(memberIDs))
+	for index, memberID := range memberIDs {
+		members[index].ObjectID = memberID.(string)
+	}
+	return members
+}
+
+func validateSecurityGroupUniversalMembers(securityGroup *SecurityGroup, nsxclient *NSXClient) error {
+	memberIDs := flattenSecurityGroupMembers(securityGroup.Members)
+	memberIDs = append(memberIDs, flattenSecurityGroupMembers(securityGroup.ExcludeMembers)...)
+	return validateUniversalReferences(memberIDs, nsxclient)
+}
+
+func flattenSecurityGroupMembers(members []SecurityGroupMember) []string {
+	memberIDs := make([]string, len(members))
+	for index, member := range members {
+		memberIDs[index] = member.ObjectID
+	}
+	return memberIDs
+}
+
+func getSecurityGroup(id string, nsxclient *NSXClient) (*SecurityGroup, error) {
+	getAPI := NewGetSecurityGroup(id)
+	err := nsxclient.Do(getAPI)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch security group %s: %s", id, err)
+	}
+
+	if err := checkerr(getAPI); err != nil {
+		// Does not exist
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return getAPI.GetResponse(), nil
+}
+
+func getSecurityGroupTranslation(id, translation string, responseObject interface{}, nsxclient *NSXClient) error {
+	getAPI := NewGetSecurityGroupTranslation(id, translation, responseObject)
+	err := nsxclient.Do(getAPI)
+
+	if err != nil {
+		return fmt.Errorf("Could not fetch %s of security group %s: %s", translation, id, err)
+	}
+
+	return checkerr(getAPI)
+}
+
+// readSecurityGroupEffectiveMembership sets the effective_* attributes to
+// what NSX currently resolves the security group to, so that membership
+// changes caused by tagging or VM moves show up on refresh.
+func readSecurityGroupEffectiveMembership(d *schema.ResourceData, id string, nsxclient *NSXClient) error {
+	vmNodes := new(SecurityGroupVMNodes)
+	if err := getSecurityGroupTranslation(id, "virtualmachines", vmNodes, nsxclient); err != nil {
+		return err
+	}
+	vms := make([]string, 0, len(vmNodes.VMNodes))
+	for _, vmNode := range vmNodes.VMNodes {
+		vms = append(vms, vmNode.VMID)
+	}
+
+	ipNodes := new(SecurityGroupIPNodes)
+	if err := getSecurityGroupTranslation(id, "ipaddresses", ipNodes, nsxclient); err != nil {
+		return err
+	}
+	ipAddresses := make([]string, 0)
+	for _, ipNode := range ipNodes.IPNodes {
+		ipAddresses = append(ipAddresses, ipNode.IPAddresses...)
+	}
+
+	macNodes := new(SecurityGroupMACNodes)
+	if err := getSecurityGroupTranslation(id, "macaddresses", macNodes, nsxclient); err != nil {
+		return err
+	}
+	macAddresses := make([]string, 0)
+	for _, macNode := range macNodes.MACNodes {
+		macAddresses = append(macAddresses, macNode.MACAddresses...)
+	}
+
+	vnicNodes := new(SecurityGroupVnicNodes)
+	if err := getSecurityGroupTranslation(id, "vnics", vnicNodes, nsxclient); err != nil {
+		return err
+	}
+	vnics := make([]string, 0, len(vnicNodes.VnicNodes))
+	for _, vnicNode := range vnicNodes.VnicNodes {
+		vnics = append(vnics, vnicNode.UUID)
+	}
+
+	d.Set("effective_vms", vms)
+	d.Set("effective_ip_addresses", ipAddresses)
+	d.Set("effective_mac_addresses", macAddresses)
+	d.Set("effective_vnics", vnics)
+	return nil
+}
+
 func resourceSecurityGroupCreate(d *schema.ResourceData, m interface{}) error {
 
-	nsxclient := m.(*gonsx.NSXClient)
-	var scopeid, name string
-	var dynamicMemberDefinition securitygroup.DynamicMemberDefinition
-	var err error
+	nsxclient := nsxClientFor(d, m)
+	var securityGroup SecurityGroup
 
 	// Gather the attributes for the resource.
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return errors.New("scopeid argument is required")
+	scopeid, err := resolveScopeID(d)
+	if err != nil {
+		return err
 	}
+	securityGroup.IsUniversal = d.Get("universal").(bool)
 
 	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
+		securityGroup.Name = v.(string)
 	} else {
 		return errors.New("name argument is required")
 	}
 
 	if v, ok := d.GetOk("dynamic_membership"); ok {
 		log.Printf(fmt.Sprintf("[DEBUG] dynamic_membership create : %+v", v))
-		dynamicMemberDefinition, err = buildDynamicMemberDefinition(v)
+		dynamicMemberDefinition, err := buildDynamicMemberDefinition(v)
 		if err != nil {
 			return err
 		}
-		//dynamicMemberDefinition, err = getDynamicMemberDefinitionFromTemplate(v)
-	} else {
-		return errors.New("dynamicmembership list is required")
+		securityGroup.DynamicMemberDefinition = &dynamicMemberDefinition
+	}
+
+	if v, ok := d.GetOk("include_members"); ok {
+		securityGroup.Members = buildSecurityGroupMembers(v)
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] securitygroup.NewCreate(%s, %s, %v", scopeid, name, dynamicMemberDefinition))
-	createAPI := securitygroup.NewCreate(scopeid, name, &dynamicMemberDefinition)
+	if v, ok := d.GetOk("exclude_members"); ok {
+		securityGroup.ExcludeMembers = buildSecurityGroupMembers(v)
+	}
+
+	if securityGroup.IsUniversal {
+		err = validateSecurityGroupUniversalMembers(&securityGroup, nsxclient)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf(fmt.Sprintf("[DEBUG] NewCreateSecurityGroup(%s, %+v)", scopeid, securityGroup))
+	createAPI := NewCreateSecurityGroup(scopeid, &securityGroup)
 	err = nsxclient.Do(createAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error creating security group: %v", err)
 	}
 
-	if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("%s", createAPI.ResponseObject())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	d.SetId(createAPI.GetResponse())
@@ -213,164 +388,160 @@ func resourceSecurityGroupCreate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceSecurityGroupRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var dynamicMembership securitygroup.DynamicMemberDefinition
-	var scopeid, name string
-	var err error
+	nsxclient := nsxClientFor(d, m)
+	id := d.Id()
 
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return errors.New("scopeid argument is required")
+	// Look the group up by its object ID so that renames, whether made by
+	// Terraform or out of band, never lose track of the object.
+	log.Printf(fmt.Sprintf("[DEBUG] NewGetSecurityGroup(%s)", id))
+	securityGroup, err := getSecurityGroup(id, nsxclient)
+	if err != nil {
+		return err
 	}
 
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return errors.New("name argument is required")
+	// If the resource has been removed manually, notify Terraform of this fact.
+	if securityGroup == nil {
+		d.SetId("")
+		return nil
 	}
 
-	if v, ok := d.GetOk("dynamic_membership"); ok {
-		dynamicMembership, err = buildDynamicMemberDefinition(v)
-		if err != nil {
-			return err
-		}
-	} else {
-		return errors.New("dynamic_membership is required")
+	d.Set("name", securityGroup.Name)
+	if securityGroup.Scope != nil {
+		d.Set("scopeid", securityGroup.Scope.ID)
 	}
+	d.Set("universal", securityGroup.IsUniversal)
 
-	// See if we can find our specifically named resource within the list of
-	// resources associated with the scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	securityGroupObject, err := getSingleSecurityGroup(scopeid, name, nsxclient)
-	if err != nil {
+	log.Printf(fmt.Sprintf("[DEBUG] dynamicMembership := %v", securityGroup.DynamicMemberDefinition))
+	if err := d.Set("dynamic_membership", flattenDynamicMemberDefinition(securityGroup.DynamicMemberDefinition)); err != nil {
 		return err
 	}
+	d.Set("include_members", flattenSecurityGroupMembers(securityGroup.Members))
+	d.Set("exclude_members", flattenSecurityGroupMembers(securityGroup.ExcludeMembers))
 
-	id := securityGroupObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
-	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
-		d.SetId("")
+	if !d.Get("read_effective_membership").(bool) {
+		for _, key := range []string{"effective_vms", "effective_ip_addresses", "effective_mac_addresses", "effective_vnics"} {
+			d.Set(key, nil)
+		}
 		return nil
 	}
-
-	log.Printf(fmt.Sprintf("[DEBUG] dynamicMembership := %v", securityGroupObject.DynamicMemberDefinition))
-	for idx, remoteDynamicSet := range securityGroupObject.DynamicMemberDefinition.DynamicSet {
-		dynamicMembership.DynamicSet[idx].Operator = remoteDynamicSet.Operator
-		readDynamicCriteria(dynamicMembership.DynamicSet[idx].DynamicCriteria,
-			remoteDynamicSet.DynamicCriteria)
-	}
-	d.Set("dynamic_membership", dynamicMembership)
-	return nil
+	return readSecurityGroupEffectiveMembership(d, id, nsxclient)
 }
 
-func readDynamicCriteria(localCriteriaList, remoteCriteriaList []securitygroup.DynamicCriteria) {
-	for _, localRule := range localCriteriaList {
-		for _, remoteRule := range remoteCriteriaList {
-			if localRule.Value == remoteRule.Value {
-				localRule.Criteria = remoteRule.Criteria
-				localRule.Key = remoteRule.Key
-				break
+// flattenDynamicMemberDefinition rebuilds the dynamic_membership list from the
+// definition returned by NSX. NSX stores an operator on every criterion, while
+// the schema has a single rules_operator per set, so the operator of the first
+// criterion is used.
+func flattenDynamicMemberDefinition(dynamicMemberDefinition *securitygroup.DynamicMemberDefinition) []interface{} {
+	dynamicMembership := make([]interface{}, 0)
+	if dynamicMemberDefinition == nil {
+		return dynamicMembership
+	}
+
+	for _, dynamicSet := range dynamicMemberDefinition.DynamicSet {
+		rulesOperator := ""
+		rules := make([]interface{}, len(dynamicSet.DynamicCriteria))
+		for index, dynamicCriteria := range dynamicSet.DynamicCriteria {
+			if index == 0 {
+				rulesOperator = dynamicCriteria.Operator
+			}
+			rules[index] = map[string]interface{}{
+				"key":      dynamicCriteria.Key,
+				"value":    dynamicCriteria.Value,
+				"criteria": dynamicCriteria.Criteria,
 			}
 		}
+		dynamicMembership = append(dynamicMembership, map[string]interface{}{
+			"set_operator":   dynamicSet.Operator,
+			"rules_operator": rulesOperator,
+			"rules":          rules,
+		})
 	}
+	return dynamicMembership
 }
 
 func resourceSecurityGroupUpdate(d *schema.ResourceData, m interface{}) error {
 
-	var scopeid string
-	var dynamicMembership securitygroup.DynamicMemberDefinition
-	var err error
-
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	hasChanges := false
+	id := d.Id()
 
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return errors.New("scopeid argument is required")
+	// Fetch the whole group so that the update does not drop any membership
+	// that Terraform is not changing.
+	log.Printf(fmt.Sprintf("[DEBUG] NewGetSecurityGroup(%s)", id))
+	securityGroupObject, err := getSecurityGroup(id, nsxclient)
+	if err != nil {
+		return err
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] securitygroup.NewGetAll(%s)", scopeid))
-	oldName, newName := d.GetChange("name")
-	securityGroupObject, err := getSingleSecurityGroup(scopeid, oldName.(string), nsxclient)
-	id := securityGroupObject.ObjectID
+	// Only Read may clear the state of a security group removed manually.
+	if securityGroupObject == nil {
+		return fmt.Errorf("security group %s no longer exists", id)
+	}
 
-	//TODO: change attributes other than name. Requires changes in gonsx.
 	if d.HasChange("name") {
 		hasChanges = true
+		oldName, newName := d.GetChange("name")
 		securityGroupObject.Name = newName.(string)
 		log.Printf(fmt.Sprintf("[DEBUG] Changing name of security group from %s to %s", oldName.(string), newName.(string)))
 	}
 
 	if d.HasChange("dynamic_membership") {
+		hasChanges = true
+		securityGroupObject.DynamicMemberDefinition = nil
 		if v, ok := d.GetOk("dynamic_membership"); ok {
-			dynamicMembership, err = buildDynamicMemberDefinition(v)
+			dynamicMembership, err := buildDynamicMemberDefinition(v)
 			if err != nil {
 				return err
 			}
+			securityGroupObject.DynamicMemberDefinition = &dynamicMembership
 		}
+	}
+
+	if d.HasChange("include_members") {
 		hasChanges = true
-		securityGroupObject.DynamicMemberDefinition = &dynamicMembership
+		securityGroupObject.Members = buildSecurityGroupMembers(d.Get("include_members"))
+	}
+
+	if d.HasChange("exclude_members") {
+		hasChanges = true
+		securityGroupObject.ExcludeMembers = buildSecurityGroupMembers(d.Get("exclude_members"))
+	}
+
+	if hasChanges && securityGroupObject.IsUniversal {
+		err = validateSecurityGroupUniversalMembers(securityGroupObject, nsxclient)
+		if err != nil {
+			return err
+		}
 	}
 
 	if hasChanges {
-		updateAPI := securitygroup.NewUpdate(id, securityGroupObject)
+		updateAPI := NewUpdateSecurityGroup(id, securityGroupObject)
 		err = nsxclient.Do(updateAPI)
 		if err != nil {
-			log.Printf(fmt.Sprintf("[DEBUG] Error updating security group: %s", err))
+			return fmt.Errorf("Error updating security group %s: %v", id, err)
+		}
+		if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 	}
 	return resourceSecurityGroupRead(d, m)
 }
 
 func resourceSecurityGroupDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name, scopeid string
+	nsxclient := nsxClientFor(d, m)
+	id := d.Id()
 
-	// Gather the attributes for the resource.
-	if v, ok := d.GetOk("scopeid"); ok {
-		scopeid = v.(string)
-	} else {
-		return errors.New("scopeid argument is required")
-	}
-
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return errors.New("name argument is required")
-	}
-
-	// Gather all the resources that are associated with the specified
-	// scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] securitygroup.NewGetAll(%s)", scopeid))
-	api := securitygroup.NewGetAll(scopeid)
-	err := nsxclient.Do(api)
+	log.Printf(fmt.Sprintf("[DEBUG] securitygroup.NewDelete(%s)", id))
+	deleteAPI := securitygroup.NewDelete(id)
+	err := nsxclient.Do(deleteAPI)
 
 	if err != nil {
 		return err
 	}
 
-	// See if we can find our specifically named resource within the list of
-	// resources associated with the scopeid.
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	securityGroupObject, err := getSingleSecurityGroup(scopeid, name, nsxclient)
-	id := securityGroupObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
-	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
-		d.SetId("")
-		return nil
-	}
-
-	// If we got here, the resource exists, so we attempt to delete it.
-	deleteAPI := securitygroup.NewDelete(id)
-	err = nsxclient.Do(deleteAPI)
-
-	if err != nil {
+	// A 404 means the group has already been removed manually, which is what
+	// we wanted anyway.
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
 		return err
 	}
 
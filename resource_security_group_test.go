@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/sky-uk/gonsx/api/securitygroup"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAccResourceSecurityGroupStaticMembership(t *testing.T) {
+	scopeID := loadServiceScopeId(t)
+	testResourceName := "nsx_security_group.static"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccResourceSecurityGroupCheckDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceSecurityGroupStaticTemplate(scopeID, "nsx_ip_set.web.id"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccResourceSecurityGroupExists(testResourceName),
+					resource.TestCheckResourceAttr(testResourceName, "include_members.#", "1"),
+					resource.TestCheckResourceAttr(testResourceName, "exclude_members.#", "0"),
+					resource.TestCheckResourceAttr(testResourceName, "dynamic_membership.#", "0"),
+				),
+			},
+			{
+				Config: testAccResourceSecurityGroupStaticTemplate(scopeID, "nsx_ip_set.web.id, nsx_ip_set.db.id"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccResourceSecurityGroupExists(testResourceName),
+					resource.TestCheckResourceAttr(testResourceName, "include_members.#", "2"),
+				),
+			},
+			{
+				ResourceName:      testResourceName,
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func testAccResourceSecurityGroupExists(resourceName string) resource.TestCheckFunc {
+	return func(state *terraform.State) error {
+		nsxClient := testAccProvider.Meta().(*NSXClient)
+
+		rs, ok := state.RootModule().Resources[resourceName]
+		if !ok {
+			return fmt.Errorf("NSX security group resource %s not found in resources", resourceName)
+		}
+
+		securityGroup, err := getSecurityGroup(rs.Primary.ID, nsxClient)
+		if err != nil {
+			return err
+		}
+		if securityGroup == nil {
+			return fmt.Errorf("NSX security group %s wasn't found", rs.Primary.ID)
+		}
+		return nil
+	}
+}
+
+func testAccResourceSecurityGroupCheckDestroy(state *terraform.State) error {
+	nsxClient := testAccProvider.Meta().(*NSXClient)
+
+	for _, rs := range state.RootModule().Resources {
+		if rs.Type != "nsx_security_group" {
+			continue
+		}
+
+		securityGroup, err := getSecurityGroup(rs.Primary.ID, nsxClient)
+		if err != nil {
+			return err
+		}
+		if securityGroup != nil {
+			return fmt.Errorf("NSX security group %s still exists", rs.Primary.ID)
+		}
+	}
+	return nil
+}
+
+func testAccResourceSecurityGroupStaticTemplate(scopeID, members string) string {
+	return fmt.Sprintf(`
+resource "nsx_ip_set" "web" {
+  name        = "tf_testing_sg_web"
+  scopeid     = "%[1]s"
+  description = "Acceptance Test"
+  value       = "10.0.0.0/24"
+}
+
+resource "nsx_ip_set" "db" {
+  name        = "tf_testing_sg_db"
+  scopeid     = "%[1]s"
+  description = "Acceptance Test"
+  value       = "10.0.1.0/24"
+}
+
+resource "nsx_security_group" "static" {
+  name            = "tf_testing_sg_static"
+  scopeid         = "%[1]s"
+  include_members = [%[2]s]
+}`, scopeID, members)
+}
+
+func TestAccDataSourceSecurityGroup(t *testing.T) {
+	scopeID := loadServiceScopeId(t)
+	testDataSourceName := "data.nsx_security_group.static"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccResourceSecurityGroupCheckDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceSecurityGroupStaticTemplate(scopeID, "nsx_ip_set.web.id") + `
+
+data "nsx_security_group" "static" {
+  name    = "${nsx_security_group.static.name}"
+  scopeid = "${nsx_security_group.static.scopeid}"
+}`,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(testDataSourceName, "id", "nsx_security_group.static", "id"),
+					resource.TestCheckResourceAttr(testDataSourceName, "include_members.#", "1"),
+					resource.TestCheckResourceAttr(testDataSourceName, "effective_ip_addresses.#", "1"),
+					resource.TestCheckResourceAttr(testDataSourceName, "effective_vms.#", "0"),
+				),
+			},
+		},
+	})
+}
+
+func TestFlattenDynamicMemberDefinition(t *testing.T) {
+	dynamicMemberDefinition := &securitygroup.DynamicMemberDefinition{
+		DynamicSet: []securitygroup.DynamicSet{
+			{
+				Operator: "OR",
+				DynamicCriteria: []securitygroup.DynamicCriteria{
+					{Operator: "AND", Key: "VM.SECURITY_TAG", Criteria: "=", Value: "web"},
+					{Operator: "AND", Key: "VM.NAME", Criteria: "starts_with", Value: "web-"},
+				},
+			},
+		},
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"set_operator":   "OR",
+			"rules_operator": "AND",
+			"rules": []interface{}{
+				map[string]interface{}{"key": "VM.SECURITY_TAG", "value": "web", "criteria": "="},
+				map[string]interface{}{"key": "VM.NAME", "value": "web-", "criteria": "starts_with"},
+			},
+		},
+	}
+
+	if actual := flattenDynamicMemberDefinition(dynamicMemberDefinition); !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %#v, got %#v", expected, actual)
+	}
+
+	if actual := flattenDynamicMemberDefinition(nil); len(actual) != 0 {
+		t.Fatalf("expected no dynamic sets, got %#v", actual)
+	}
+}
+
+func TestResourceSecurityGroupReadEffectiveMembership(t *testing.T) {
+	translations := map[string]string{
+		"virtualmachines": "<vmnodes><vmnode><vmId>vm-1</vmId><vmName>web-01</vmName></vmnode></vmnodes>",
+		"ipaddresses":     "<ipNodes><ipNode><ipAddresses><string>10.0.0.1</string></ipAddresses></ipNode></ipNodes>",
+		"macaddresses":    "<macNodes><macNode><macAddresses><string>00:50:56:00:00:01</string></macAddresses></macNode></macNodes>",
+		"vnics":           "<vnicNodes><vnicNode><uuid>vnic-1</uuid></vnicNode></vnicNodes>",
+	}
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/securitygroup/securitygroup-1", "<securitygroup><objectId>securitygroup-1</objectId><name>web</name></securitygroup>")
+	for translation, response := range translations {
+		server.respond("/api/2.0/services/securitygroup/securitygroup-1/translation/"+translation, response)
+	}
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityGroup().Schema, map[string]interface{}{"name": "web", "read_effective_membership": false})
+	d.SetId("securitygroup-1")
+	if err := resourceSecurityGroupRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	for translation := range translations {
+		if server.requested(http.MethodGet, "/api/2.0/services/securitygroup/securitygroup-1/translation/"+translation) != 0 {
+			t.Errorf("expected no %s translation with read_effective_membership = false", translation)
+		}
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceSecurityGroup().Schema, map[string]interface{}{"name": "web"})
+	d.SetId("securitygroup-1")
+	if err := resourceSecurityGroupRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"effective_vms":           "vm-1",
+		"effective_ip_addresses":  "10.0.0.1",
+		"effective_mac_addresses": "00:50:56:00:00:01",
+		"effective_vnics":         "vnic-1",
+	}
+	for key, value := range expected {
+		if members := d.Get(key).(*schema.Set).List(); len(members) != 1 || members[0] != value {
+			t.Errorf("expected %s to be [%s], got %v", key, value, members)
+		}
+	}
+}
+
+func TestResourceSecurityGroupUpdateMissing(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityGroup().Schema, map[string]interface{}{"name": "web"})
+	d.SetId("securitygroup-1")
+	if err := resourceSecurityGroupUpdate(d, nsxclient); err == nil {
+		t.Fatal("expected an error for a security group which no longer exists")
+	}
+	if d.Id() != "securitygroup-1" {
+		t.Fatalf("expected the ID to be kept, got %q", d.Id())
+	}
+	if server.requested(http.MethodPut, "/api/2.0/services/securitygroup/bulk/securitygroup-1") != 0 {
+		t.Fatal("expected no update of a security group which no longer exists")
+	}
+}
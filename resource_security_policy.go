@@ -3,29 +3,116 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/sky-uk/gonsx/api/securitypolicy"
 	"log"
+	"strconv"
+	"time"
 )
 
-func getSingleSecurityPolicy(name string, nsxclient *gonsx.NSXClient) (*securitypolicy.SecurityPolicy, error) {
-	getAllAPI := securitypolicy.NewGetAll()
+func getAllSecurityPolicies(nsxclient *NSXClient) ([]SecurityPolicy, error) {
+	getAllAPI := NewGetAllSecurityPolicies()
 	err := nsxclient.Do(getAllAPI)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if getAllAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAPI.StatusCode(), getAllAPI.ResponseObject())
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
+	}
+
+	return getAllAPI.GetResponse().SecurityPolicies, nil
+}
+
+func getSingleSecurityPolicy(name string, nsxclient *NSXClient) (*SecurityPolicy, error) {
+	securityPolicies, err := getAllSecurityPolicies(nsxclient)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] getAllAPI.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	securityPolicy := getAllAPI.GetResponse().FilterByName(name)
+	log.Printf(fmt.Sprintf("[DEBUG] SecurityPolicies.FilterByName(\"%s\").ObjectID", name))
+	securityPolicy := SecurityPolicies{SecurityPolicies: securityPolicies}.FilterByName(name)
 
 	return securityPolicy, nil
 }
 
+func getSecurityPolicy(id string, nsxclient *NSXClient) (*SecurityPolicy, error) {
+	getAPI := NewGetSecurityPolicy(id)
+	err := nsxclient.Do(getAPI)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not fetch security policy %s: %s", id, err)
+	}
+
+	if err := checkerr(getAPI); err != nil {
+		// Does not exist
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return getAPI.GetResponse(), nil
+}
+
+// securityPolicyUpdateAttempts is how often a read-modify-write of a security
+// policy is tried before a revision conflict is reported.
+const securityPolicyUpdateAttempts = 5
+
+// securityPolicyRetryBackoff is the pause after the first conflict, it grows
+// with every further attempt.
+var securityPolicyRetryBackoff = time.Second
+
+// modifySecurityPolicy applies modify to the current version of the security
+// policy and writes it back. Policies are updated as a whole, so rules and
+// bindings of the same policy are serialized on its ID, the revision read is
+// sent back for optimistic concurrency, and the whole read-modify-write is
+// retried when somebody else changed the policy in between. modify returns
+// false when the policy needs no change.
+func modifySecurityPolicy(id string, nsxclient *NSXClient, modify func(*SecurityPolicy) (bool, error)) error {
+	nsxMutexKV.Lock(id)
+	defer nsxMutexKV.Unlock(id)
+
+	for attempt := 1; ; attempt++ {
+		securityPolicy, err := getSecurityPolicy(id, nsxclient)
+		if err != nil {
+			return err
+		}
+		if securityPolicy == nil {
+			return fmt.Errorf("Security policy %s not found", id)
+		}
+
+		changed, err := modify(securityPolicy)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+
+		log.Printf("[DEBUG] Updating security policy %s at revision %d (attempt %d)", id, securityPolicy.Revision, attempt)
+		updateAPI := NewUpdateSecurityPolicy(id, securityPolicy)
+		err = nsxclient.Do(updateAPI)
+		if err != nil {
+			return fmt.Errorf("Error updating security policy %s: %v", id, err)
+		}
+
+		err = checkerr(updateAPI)
+		if err == nil {
+			return nil
+		}
+
+		// NSX rejects the update if the policy was modified since it was read.
+		if attempt >= securityPolicyUpdateAttempts || !isConflictError(err) {
+			return err
+		}
+
+		log.Printf("[DEBUG] Security policy %s was modified concurrently, retrying", id)
+		time.Sleep(time.Duration(attempt) * securityPolicyRetryBackoff)
+	}
+}
+
 func resourceSecurityPolicy() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceSecurityPolicyCreate,
@@ -33,6 +120,10 @@ func resourceSecurityPolicy() *schema.Resource {
 		Delete: resourceSecurityPolicyDelete,
 		Update: resourceSecurityPolicyUpdate,
 
+		// Version 1 made precedence an integer.
+		SchemaVersion: 1,
+		MigrateState:  resourceSecurityPolicyMigrateState,
+
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -40,9 +131,33 @@ func resourceSecurityPolicy() *schema.Resource {
 				ForceNew: true,
 			},
 			"precedence": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:          schema.TypeInt,
+				Optional:      true,
+				Computed:      true,
+				ValidateFunc:  validation.IntAtLeast(1),
+				ConflictsWith: []string{"auto_precedence"},
+			},
+			"auto_precedence": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				MaxItems:    1,
+				Description: "Place the policy directly before or after a sibling policy instead of setting precedence",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"before": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the policy to take precedence over",
+						},
+						"after": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Description: "Name of the policy to yield precedence to",
+						},
+					},
+				},
 			},
+			"neighbors": schemaSecurityPolicyList(),
 			"description": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -52,15 +167,25 @@ func resourceSecurityPolicy() *schema.Resource {
 				Optional: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
 			},
+			"parent": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "ID of the security policy to inherit actions from",
+			},
+			"inheritance_allowed": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Allow other security policies to inherit from this one",
+			},
 		},
 	}
 }
 
 func resourceSecurityPolicyCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var name, description, precedence string
 	var securitygroups []string
-	var actions []securitypolicy.Action
 
 	// Gather the attributes for the resource.
 
@@ -70,10 +195,32 @@ func resourceSecurityPolicyCreate(d *schema.ResourceData, meta interface{}) erro
 		return fmt.Errorf("name argument is required")
 	}
 
-	if v, ok := d.GetOk("precedence"); ok {
-		precedence = v.(string)
+	// Hold the precedence lock from checking that the precedence is free
+	// until the policy is created, so that policies created in parallel do
+	// not pick the same one.
+	nsxMutexKV.Lock(securityPolicyPrecedenceMutexKey)
+	defer nsxMutexKV.Unlock(securityPolicyPrecedenceMutexKey)
+
+	securityPolicies, err := getAllSecurityPolicies(nsxclient)
+	if err != nil {
+		return err
+	}
+
+	if sibling, before, ok := securityPolicyPlacement(d); ok {
+		if sibling == "" {
+			return fmt.Errorf("auto_precedence requires one of before or after")
+		}
+		precedence, err = autoSecurityPolicyPrecedence(securityPolicies, "", sibling, before)
+		if err != nil {
+			return err
+		}
+	} else if v, ok := d.GetOk("precedence"); ok {
+		precedence = strconv.Itoa(v.(int))
+		if err := checkSecurityPolicyPrecedenceFree(securityPolicies, "", precedence); err != nil {
+			return err
+		}
 	} else {
-		return fmt.Errorf("precedence argument is required")
+		return fmt.Errorf("one of precedence or auto_precedence is required")
 	}
 
 	if v, ok := d.GetOk("description"); ok {
@@ -96,16 +243,29 @@ func resourceSecurityPolicyCreate(d *schema.ResourceData, meta interface{}) erro
 		securitygroups = make([]string, 0)
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] securitypolicy.NewCreate(%s, %s, %s, %s, %v)", name, precedence, description, securitygroups, actions))
-	createAPI := securitypolicy.NewCreate(name, precedence, description, securitygroups, actions)
-	err := nsxclient.Do(createAPI)
+	securityPolicy := &SecurityPolicy{
+		Name:               name,
+		Description:        description,
+		Precedence:         precedence,
+		InheritanceAllowed: d.Get("inheritance_allowed").(bool),
+	}
+	if v, ok := d.GetOk("parent"); ok {
+		securityPolicy.Parent = &SecurityPolicyParent{ObjectID: v.(string)}
+	}
+	for _, securityGroupID := range securitygroups {
+		securityPolicy.AddSecurityGroupBinding(securityGroupID)
+	}
+
+	log.Printf(fmt.Sprintf("[DEBUG] NewCreateSecurityPolicy(%s, %s, %s, %s)", name, precedence, description, securitygroups))
+	createAPI := NewCreateSecurityPolicy(securityPolicy)
+	err = nsxclient.Do(createAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error creating security policy: %v", err)
 	}
 
-	if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("%s", createAPI.ResponseObject())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	d.SetId(createAPI.GetResponse())
@@ -113,7 +273,7 @@ func resourceSecurityPolicyCreate(d *schema.ResourceData, meta interface{}) erro
 }
 
 func resourceSecurityPolicyRead(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var name string
 
 	if v, ok := d.GetOk("name"); ok {
@@ -122,22 +282,45 @@ func resourceSecurityPolicyRead(d *schema.ResourceData, meta interface{}) error
 		return fmt.Errorf("name argument is required")
 	}
 
-	securityPolicyObject, err := getSingleSecurityPolicy(name, nsxclient)
+	securityPolicies, err := getAllSecurityPolicies(nsxclient)
 	if err != nil {
 		return err
 	}
+	securityPolicyObject := SecurityPolicies{SecurityPolicies: securityPolicies}.FilterByName(name)
 	id := securityPolicyObject.ObjectID
 	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
 
 	// If the resource has been removed manually, notify Terraform of this fact.
 	if id == "" {
 		d.SetId("")
+		return nil
+	}
+
+	precedence, err := strconv.Atoi(securityPolicyObject.Precedence)
+	if err != nil {
+		return fmt.Errorf("Invalid precedence %q of security policy %s: %v", securityPolicyObject.Precedence, id, err)
+	}
+	d.Set("precedence", precedence)
+	d.Set("neighbors", flattenSecurityPolicyList(securityPolicyNeighbors(securityPolicies, id)))
+
+	// Forget the placement once the policy is no longer on the requested side
+	// of its sibling, so that the next plan moves it back.
+	if sibling, before, ok := securityPolicyPlacement(d); ok && !checkSecurityPolicyPlacement(securityPolicies, id, sibling, before) {
+		log.Printf("[DEBUG] Security policy %s is no longer placed relative to %s", name, sibling)
+		d.Set("auto_precedence", nil)
+	}
+
+	if securityPolicyObject.Parent != nil {
+		d.Set("parent", securityPolicyObject.Parent.ObjectID)
+	} else {
+		d.Set("parent", "")
 	}
+	d.Set("inheritance_allowed", securityPolicyObject.InheritanceAllowed)
 	return nil
 }
 
 func resourceSecurityPolicyDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var name string
 
 	if v, ok := d.GetOk("name"); ok {
@@ -168,6 +351,10 @@ func resourceSecurityPolicyDelete(d *schema.ResourceData, meta interface{}) erro
 		return err
 	}
 
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
 	// If we got here, the resource had existed, we deleted it and there was
 	// no error.  Notify Terraform of this fact and return successful
 	// completion.
@@ -178,10 +365,7 @@ func resourceSecurityPolicyDelete(d *schema.ResourceData, meta interface{}) erro
 }
 
 func resourceSecurityPolicyUpdate(d *schema.ResourceData, meta interface{}) error {
-	// flag if changes have to be applied
-	hasChanges := false
-
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var name string
 	var securitygroups []string
 
@@ -191,12 +375,12 @@ func resourceSecurityPolicyUpdate(d *schema.ResourceData, meta interface{}) erro
 		return fmt.Errorf("name argument is required")
 	}
 
-	securityPolicyToChange, err := getSingleSecurityPolicy(name, nsxclient)
+	securityPolicyObject, err := getSingleSecurityPolicy(name, nsxclient)
 	if err != nil {
 		return err
 	}
 
-	id := securityPolicyToChange.ObjectID
+	id := securityPolicyObject.ObjectID
 	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
 
 	// If the resource is not found, notify Terraform of this fact.
@@ -205,58 +389,95 @@ func resourceSecurityPolicyUpdate(d *schema.ResourceData, meta interface{}) erro
 		return nil
 	}
 
-	// Update resource properties.
-	if d.HasChange("description") {
-		hasChanges = true
-		securityPolicyToChange.Description = d.Get("description").(string)
+	if v, ok := d.GetOk("securitygroups"); ok {
+		list := v.([]interface{})
+
+		securitygroups = make([]string, len(list))
+		for i, value := range list {
+			groupID, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("empty element found in securitygroups")
+			}
+			securitygroups[i] = groupID
+		}
+	} else {
+		securitygroups = make([]string, 0)
 	}
 
-	if d.HasChange("precedence") {
-		hasChanges = true
-		securityPolicyToChange.Precedence = d.Get("precedence").(string)
+	var precedence string
+	if d.HasChange("precedence") || d.HasChange("auto_precedence") {
+		nsxMutexKV.Lock(securityPolicyPrecedenceMutexKey)
+		defer nsxMutexKV.Unlock(securityPolicyPrecedenceMutexKey)
 	}
+	if sibling, before, ok := securityPolicyPlacement(d); ok && d.HasChange("auto_precedence") {
+		if sibling == "" {
+			return fmt.Errorf("auto_precedence requires one of before or after")
+		}
+		securityPolicies, err := getAllSecurityPolicies(nsxclient)
+		if err != nil {
+			return err
+		}
+		if precedence, err = autoSecurityPolicyPrecedence(securityPolicies, id, sibling, before); err != nil {
+			return err
+		}
+	} else if d.HasChange("precedence") {
+		securityPolicies, err := getAllSecurityPolicies(nsxclient)
+		if err != nil {
+			return err
+		}
+		precedence = strconv.Itoa(d.Get("precedence").(int))
+		if err := checkSecurityPolicyPrecedenceFree(securityPolicies, id, precedence); err != nil {
+			return err
+		}
+	}
+
+	err = modifySecurityPolicy(id, nsxclient, func(securityPolicyToChange *SecurityPolicy) (bool, error) {
+		// flag if changes have to be applied
+		hasChanges := false
 
-	if d.HasChange("securitygroups") {
-		hasChanges = true
+		// Update resource properties.
+		if d.HasChange("description") {
+			hasChanges = true
+			securityPolicyToChange.Description = d.Get("description").(string)
+		}
 
-		// TODO: fix this when API is updated, for now we remove everything first.
-		for _, securityGroup := range securityPolicyToChange.SecurityGroupBinding {
-			securityPolicyToChange.RemoveSecurityGroupBinding(securityGroup.ObjectID)
+		if precedence != "" && precedence != securityPolicyToChange.Precedence {
+			hasChanges = true
+			securityPolicyToChange.Precedence = precedence
 		}
 
-		if v, ok := d.GetOk("securitygroups"); ok {
-			list := v.([]interface{})
+		if d.HasChange("securitygroups") {
+			hasChanges = true
 
-			securitygroups = make([]string, len(list))
-			for i, value := range list {
-				groupID, ok := value.(string)
-				if !ok {
-					return fmt.Errorf("empty element found in securitygroups")
-				}
-				securitygroups[i] = groupID
+			// Only touch the groups this resource manages, bindings made with
+			// nsx_security_policy_binding or outside Terraform are kept.
+			oldSecurityGroups, _ := d.GetChange("securitygroups")
+			for _, securityGroupID := range oldSecurityGroups.([]interface{}) {
+				securityPolicyToChange.RemoveSecurityGroupBinding(securityGroupID.(string))
+			}
+			for _, securityGroupID := range securitygroups {
+				securityPolicyToChange.AddSecurityGroupBinding(securityGroupID)
 			}
-		} else {
-			securitygroups = make([]string, 0)
 		}
 
-		for _, securityGroupID := range securitygroups {
-			securityPolicyToChange.AddSecurityGroupBinding(securityGroupID)
+		if d.HasChange("parent") {
+			hasChanges = true
+			securityPolicyToChange.Parent = nil
+			if v, ok := d.GetOk("parent"); ok {
+				securityPolicyToChange.Parent = &SecurityPolicyParent{ObjectID: v.(string)}
+			}
 		}
-	}
 
-	// do nothing if there are no changes
-	if !hasChanges {
-		return nil
-	}
-
-	securityPolicyToChange.Revision += securityPolicyToChange.Revision
-	updateAPI := securitypolicy.NewUpdate(id, securityPolicyToChange)
-	err = nsxclient.Do(updateAPI)
+		if d.HasChange("inheritance_allowed") {
+			hasChanges = true
+			securityPolicyToChange.InheritanceAllowed = d.Get("inheritance_allowed").(bool)
+		}
 
+		return hasChanges, nil
+	})
 	if err != nil {
 		return err
 	}
 
 	return resourceSecurityPolicyRead(d, meta)
-
 }
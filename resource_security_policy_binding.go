@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+	"strings"
+)
+
+func resourceSecurityPolicyBinding() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceSecurityPolicyBindingCreate,
+		Read:   resourceSecurityPolicyBindingRead,
+		Delete: resourceSecurityPolicyBindingDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"security_policy_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"security_group_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+		},
+	}
+}
+
+func resourceSecurityPolicyBindingCreate(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityPolicyID := d.Get("security_policy_id").(string)
+	securityGroupID := d.Get("security_group_id").(string)
+
+	// Applying a binding changes the revision of the policy.
+	nsxMutexKV.Lock(securityPolicyID)
+	defer nsxMutexKV.Unlock(securityPolicyID)
+
+	log.Printf(fmt.Sprintf("[DEBUG] NewApplySecurityPolicyBinding(%s, %s)", securityPolicyID, securityGroupID))
+	applyAPI := NewApplySecurityPolicyBinding(securityPolicyID, securityGroupID)
+	err := nsxclient.Do(applyAPI)
+
+	if err != nil {
+		return fmt.Errorf("Error applying security policy %s to security group %s: %v", securityPolicyID, securityGroupID, err)
+	}
+
+	if err := checkerr(applyAPI); err != nil {
+		return err
+	}
+
+	d.SetId(securityPolicyID + ":" + securityGroupID)
+	return resourceSecurityPolicyBindingRead(d, m)
+}
+
+func resourceSecurityPolicyBindingRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+
+	s := strings.Split(d.Id(), ":")
+	if len(s) != 2 {
+		return fmt.Errorf("Invalid security policy binding ID %s, expected <security policy ID>:<security group ID>", d.Id())
+	}
+	securityPolicyID, securityGroupID := s[0], s[1]
+
+	securityPolicy, err := getSecurityPolicy(securityPolicyID, nsxclient)
+	if err != nil {
+		return err
+	}
+
+	if securityPolicy != nil {
+		for _, securityGroup := range securityPolicy.SecurityGroupBinding {
+			if securityGroup.ObjectID == securityGroupID {
+				// Found
+				d.Set("security_policy_id", securityPolicyID)
+				d.Set("security_group_id", securityGroupID)
+				return nil
+			}
+		}
+	}
+
+	// Not found
+	log.Printf("[DEBUG] Security policy %s is no longer applied to security group %s", securityPolicyID, securityGroupID)
+	d.SetId("")
+	return nil
+}
+
+func resourceSecurityPolicyBindingDelete(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityPolicyID := d.Get("security_policy_id").(string)
+	securityGroupID := d.Get("security_group_id").(string)
+
+	nsxMutexKV.Lock(securityPolicyID)
+	defer nsxMutexKV.Unlock(securityPolicyID)
+
+	log.Printf(fmt.Sprintf("[DEBUG] NewRemoveSecurityPolicyBinding(%s, %s)", securityPolicyID, securityGroupID))
+	removeAPI := NewRemoveSecurityPolicyBinding(securityPolicyID, securityGroupID)
+	err := nsxclient.Do(removeAPI)
+
+	if err != nil {
+		return fmt.Errorf("Error unapplying security policy %s from security group %s: %v", securityPolicyID, securityGroupID, err)
+	}
+
+	// The policy or the binding is already gone.
+	if err := checkerr(removeAPI); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"testing"
+)
+
+func TestResourceSecurityPolicyBinding(t *testing.T) {
+	bound := map[string]bool{"securitygroup-1": true}
+
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/policy/securitypolicy/policy-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, "<securityPolicy><objectId>policy-1</objectId><name>p</name><precedence>5000</precedence>")
+		for securityGroupID := range bound {
+			fmt.Fprintf(w, "<securityGroupBinding><objectId>%s</objectId></securityGroupBinding>", securityGroupID)
+		}
+		fmt.Fprint(w, "</securityPolicy>")
+	})
+	server.handle(http.MethodPost, "/api/2.0/services/policy/securitypolicy/policy-1/sgbinding/securitygroup-2", func(w http.ResponseWriter, r *http.Request) {
+		bound["securitygroup-2"] = true
+	})
+	server.handle(http.MethodDelete, "/api/2.0/services/policy/securitypolicy/policy-1/sgbinding/securitygroup-2", func(w http.ResponseWriter, r *http.Request) {
+		delete(bound, "securitygroup-2")
+	})
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityPolicyBinding().Schema, map[string]interface{}{
+		"security_policy_id": "policy-1",
+		"security_group_id":  "securitygroup-2",
+	})
+
+	if err := resourceSecurityPolicyBindingCreate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "policy-1:securitygroup-2" {
+		t.Fatalf("unexpected ID %s", d.Id())
+	}
+
+	if err := resourceSecurityPolicyBindingDelete(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if !bound["securitygroup-1"] || bound["securitygroup-2"] {
+		t.Fatalf("unexpected bindings after delete: %v", bound)
+	}
+
+	d.SetId("policy-1:securitygroup-2")
+	if err := resourceSecurityPolicyBindingRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected the removed binding to be dropped from state, got ID %s", d.Id())
+	}
+}
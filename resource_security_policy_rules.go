@@ -3,7 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/sky-uk/gonsx/api/securitypolicy"
 	"log"
 )
@@ -12,6 +12,7 @@ func resourceSecurityPolicyRule() *schema.Resource {
 	return &schema.Resource{
 		Create: resourceSecurityPolicyRuleCreate,
 		Read:   resourceSecurityPolicyRuleRead,
+		Update: resourceSecurityPolicyRuleUpdate,
 		Delete: resourceSecurityPolicyRuleDelete,
 
 		Schema: map[string]*schema.Schema{
@@ -19,7 +20,6 @@ func resourceSecurityPolicyRule() *schema.Resource {
 			"name": {
 				Type:     schema.TypeString,
 				Required: true,
-				ForceNew: true,
 			},
 
 			"securitypolicyname": {
@@ -28,39 +28,167 @@ func resourceSecurityPolicyRule() *schema.Resource {
 				ForceNew: true,
 			},
 
+			"category": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     securityPolicyCategoryFirewall,
+				Description: "firewall, endpoint (guest introspection) or traffic_steering (network introspection)",
+				ValidateFunc: validation.StringInSlice([]string{
+					securityPolicyCategoryFirewall,
+					securityPolicyCategoryEndpoint,
+					securityPolicyCategoryTrafficSteering,
+				}, false),
+			},
+
 			"action": {
 				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Optional: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					"allow",
+					"block",
+				}, false),
 			},
 
 			"direction": {
 				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Optional: true,
+				ValidateFunc: validation.StringInSlice([]string{
+					"inbound",
+					"outbound",
+					"intra",
+				}, false),
 			},
 
 			"securitygroupids": {
 				Type:     schema.TypeList,
-				ForceNew: true,
 				Optional: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
 			},
 
 			"serviceids": {
 				Type:     schema.TypeList,
-				Required: true,
-				ForceNew: true,
+				Optional: true,
 				Elem:     &schema.Schema{Type: schema.TypeString},
 			},
+
+			"enabled": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+
+			"logged": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+
+			"service_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Guest introspection service of an endpoint action",
+			},
+
+			"service_profile_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Service profile of an endpoint or traffic_steering action",
+			},
+
+			"enforced": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Enforce an endpoint action on child policies",
+			},
+
+			"redirect": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Redirect the traffic matched by a traffic_steering action to the service profile",
+			},
 		},
 	}
 }
 
+// buildSecurityPolicyAction builds the action described by the resource,
+// checking the arguments required by its category.
+func buildSecurityPolicyAction(d *schema.ResourceData) (*Action, error) {
+	category := d.Get("category").(string)
+	action := &Action{
+		Class:     securityPolicyActionClasses[category],
+		Name:      d.Get("name").(string),
+		Category:  category,
+		IsEnabled: d.Get("enabled").(bool),
+	}
+
+	securitygroupids, err := getListOfStrings(d, "securitygroupids")
+	if err != nil {
+		return nil, err
+	}
+	serviceids, err := getListOfStrings(d, "serviceids")
+	if err != nil {
+		return nil, err
+	}
+	serviceProfileID := d.Get("service_profile_id").(string)
+
+	switch category {
+	case securityPolicyCategoryFirewall:
+		if d.Get("action").(string) == "" {
+			return nil, fmt.Errorf("action argument is required for firewall rules")
+		}
+		if d.Get("direction").(string) == "" {
+			return nil, fmt.Errorf("direction argument is required for firewall rules")
+		}
+		if len(serviceids) == 0 {
+			return nil, fmt.Errorf("serviceids argument is required for firewall rules")
+		}
+		action.Action = d.Get("action").(string)
+		action.Direction = d.Get("direction").(string)
+		action.Logged = d.Get("logged").(bool)
+
+	case securityPolicyCategoryEndpoint:
+		if d.Get("service_id").(string) == "" {
+			return nil, fmt.Errorf("service_id argument is required for endpoint rules")
+		}
+		action.ServiceID = d.Get("service_id").(string)
+		action.IsActionEnforced = d.Get("enforced").(bool)
+		if serviceProfileID != "" {
+			action.ServiceProfile = &ServiceProfile{ObjectID: serviceProfileID}
+		}
+		return action, nil
+
+	case securityPolicyCategoryTrafficSteering:
+		if serviceProfileID == "" {
+			return nil, fmt.Errorf("service_profile_id argument is required for traffic_steering rules")
+		}
+		redirect := d.Get("redirect").(bool)
+		action.Redirect = &redirect
+		action.ServiceProfile = &ServiceProfile{ObjectID: serviceProfileID}
+		action.Direction = d.Get("direction").(string)
+		action.Logged = d.Get("logged").(bool)
+	}
+
+	// Firewall and traffic steering actions match on secondary security
+	// groups and services.
+	for _, securityGroupID := range securitygroupids {
+		action.SecondarySecurityGroup = append(action.SecondarySecurityGroup, securitypolicy.SecurityGroup{ObjectID: securityGroupID})
+	}
+	if len(serviceids) > 0 && serviceids[0] != "any" {
+		action.Applications = &securitypolicy.Applications{}
+		for _, serviceID := range serviceids {
+			action.Applications.Applications = append(action.Applications.Applications, securitypolicy.Application{ObjectID: serviceID})
+		}
+	}
+
+	return action, nil
+}
+
 func resourceSecurityPolicyRuleCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name, securitypolicyname, action, direction string
-	var securitygroupids, serviceids []string
+	nsxclient := nsxClientFor(d, m)
+	var name, securitypolicyname string
 
 	// Gather the attributes for the resource.
 
@@ -76,105 +204,55 @@ func resourceSecurityPolicyRuleCreate(d *schema.ResourceData, m interface{}) err
 		return fmt.Errorf("securitypolicyname argument is required")
 	}
 
-	if v, ok := d.GetOk("action"); ok {
-		action = v.(string)
-	} else {
-		return fmt.Errorf("action argument is required")
-	}
-
-	if v, ok := d.GetOk("direction"); ok {
-		direction = v.(string)
-	} else {
-		return fmt.Errorf("direction argument is required")
-	}
-
-	if v, ok := d.GetOk("securitygroupids"); ok {
-		list := v.([]interface{})
-
-		securitygroupids = make([]string, len(list))
-		for i, value := range list {
-			groupID, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("empty element found in securitygroups")
-			}
-			securitygroupids[i] = groupID
-		}
-	} else {
-		if action == "outbound" {
-			return fmt.Errorf("securitygroupids argument is required")
-		}
-	}
-
-	if v, ok := d.GetOk("serviceids"); ok {
-		list := v.([]interface{})
-
-		serviceids = make([]string, len(list))
-		for i, value := range list {
-			serviceID, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("empty element found in services")
-			}
-			serviceids[i] = serviceID
-		}
-	} else {
-		return fmt.Errorf("serviceids argument is required")
+	newAction, err := buildSecurityPolicyAction(d)
+	if err != nil {
+		return err
 	}
 
 	log.Print("Getting policy object to modify")
 	policyToModify, err := getSingleSecurityPolicy(securitypolicyname, nsxclient)
-	log.Printf("[DEBUG] - policyTOModify :%s", policyToModify)
-
 	if err != nil {
 		return err
 	}
-
-	existingAction := policyToModify.GetFirewallRuleByName(name)
-	if existingAction.Name != "" {
-		return fmt.Errorf("Firewall rule with same name already exists in this security policy")
+	if policyToModify.ObjectID == "" {
+		return fmt.Errorf("Security policy %s not found", securitypolicyname)
 	}
 
-	if direction == "inbound" {
-		log.Printf("[DEBUG] policyToModify.AddInboundFirewallAction(%s, %s, %s, %s)", name, action, direction, serviceids)
-		modifyErr := policyToModify.AddInboundFirewallAction(name, action, direction, securitygroupids, serviceids)
-		if err != nil {
-			return fmt.Errorf("Error in adding the rule to policy object: %s", modifyErr)
-		}
-	} else {
-		log.Printf(fmt.Sprintf("[DEBUG] policyToModify.AddOutboundFirewallAction(%s, %s, %s, %s, %s)", name, action, direction, securitygroupids, serviceids))
-		modifyErr := policyToModify.AddOutboundFirewallAction(name, action, direction, securitygroupids, serviceids)
-		if err != nil {
-			return fmt.Errorf("Error in adding the rule to policy object: %s", modifyErr)
+	err = modifySecurityPolicy(policyToModify.ObjectID, nsxclient, func(securityPolicy *SecurityPolicy) (bool, error) {
+		existingAction := securityPolicy.GetActionByName(name)
+		if existingAction.Name != "" {
+			return false, fmt.Errorf("Rule with same name already exists in this security policy")
 		}
-	}
 
-	log.Printf("[DEBUG] - policyTOModify :%s", policyToModify)
-	policyToModify.Revision += policyToModify.Revision
-	updateAPI := securitypolicy.NewUpdate(policyToModify.ObjectID, policyToModify)
-
-	err = nsxclient.Do(updateAPI)
+		log.Printf(fmt.Sprintf("[DEBUG] securityPolicy.AddAction(%s, %s)", name, newAction.Category))
+		securityPolicy.AddAction(*newAction)
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating security policy rule: %v", err)
+	}
 
+	securityPolicy, err := getSecurityPolicy(policyToModify.ObjectID, nsxclient)
 	if err != nil {
-		return fmt.Errorf("Error creating security group: %v", err)
+		return err
+	}
+	if securityPolicy == nil {
+		return fmt.Errorf("Security policy %s not found", securitypolicyname)
 	}
 
-	if updateAPI.StatusCode() != 200 {
-		return fmt.Errorf("%s", updateAPI.ResponseObject())
+	id := securityPolicy.GetActionByName(name).VsmUUID
+	if id == "" {
+		return fmt.Errorf("Rule %s not found in security policy %s after creating it", name, securitypolicyname)
 	}
 
-	d.SetId(name)
+	d.SetId(id)
 	return resourceSecurityPolicyRuleRead(d, m)
 }
 
 func resourceSecurityPolicyRuleRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name string
+	nsxclient := nsxClientFor(d, m)
 	var securitypolicyname string
 
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return fmt.Errorf("name argument is required")
-	}
 	if v, ok := d.GetOk("securitypolicyname"); ok {
 		securitypolicyname = v.(string)
 	} else {
@@ -188,19 +266,106 @@ func resourceSecurityPolicyRuleRead(d *schema.ResourceData, m interface{}) error
 		return err
 	}
 
-	existingAction := policyToRead.GetFirewallRuleByName(name)
+	existingAction := policyToRead.GetActionByUUID(d.Id())
+	if existingAction.VsmUUID == "" {
+		// Rules created by older versions of the provider used their name as ID.
+		existingAction = policyToRead.GetActionByName(d.Id())
+	}
 	id := existingAction.VsmUUID
 	log.Printf("[DEBUG] VsmUUID := %s", id)
 
 	// If the resource has been removed manually, notify Terraform of this fact.
 	if id == "" {
 		d.SetId("")
+		return nil
+	}
+
+	d.SetId(id)
+	d.Set("name", existingAction.Name)
+	d.Set("category", existingAction.Category)
+	d.Set("action", existingAction.Action)
+	d.Set("direction", existingAction.Direction)
+	d.Set("enabled", existingAction.IsEnabled)
+	d.Set("logged", existingAction.Logged)
+	d.Set("service_id", existingAction.ServiceID)
+	d.Set("enforced", existingAction.IsActionEnforced)
+	if existingAction.Redirect != nil {
+		d.Set("redirect", *existingAction.Redirect)
+	}
+	if existingAction.ServiceProfile != nil {
+		d.Set("service_profile_id", existingAction.ServiceProfile.ObjectID)
+	} else {
+		d.Set("service_profile_id", "")
+	}
+
+	securitygroupids := make([]string, 0, len(existingAction.SecondarySecurityGroup))
+	for _, securityGroup := range existingAction.SecondarySecurityGroup {
+		securitygroupids = append(securitygroupids, securityGroup.ObjectID)
+	}
+	d.Set("securitygroupids", securitygroupids)
+
+	serviceids := make([]string, 0)
+	if existingAction.Applications != nil {
+		for _, application := range existingAction.Applications.Applications {
+			serviceids = append(serviceids, application.ObjectID)
+		}
+	}
+	// NSX stores "any" as the absence of services.
+	if configured, err := getListOfStrings(d, "serviceids"); err == nil && len(serviceids) == 0 && len(configured) == 1 && configured[0] == "any" {
+		serviceids = configured
 	}
+	d.Set("serviceids", serviceids)
+
 	return nil
 }
 
+func resourceSecurityPolicyRuleUpdate(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityPolicyName := d.Get("securitypolicyname").(string)
+
+	newAction, err := buildSecurityPolicyAction(d)
+	if err != nil {
+		return err
+	}
+
+	log.Print("Getting policy object to modify")
+	policyToModify, err := getSingleSecurityPolicy(securityPolicyName, nsxclient)
+	if err != nil {
+		return err
+	}
+	if policyToModify.ObjectID == "" {
+		return fmt.Errorf("Security policy %s not found", securityPolicyName)
+	}
+
+	err = modifySecurityPolicy(policyToModify.ObjectID, nsxclient, func(securityPolicy *SecurityPolicy) (bool, error) {
+		existingAction := securityPolicy.GetActionByUUID(d.Id())
+		if existingAction.VsmUUID == "" {
+			return false, fmt.Errorf("Rule %s not found in security policy %s", d.Id(), securityPolicyName)
+		}
+		if sameName := securityPolicy.GetActionByName(newAction.Name); sameName.Name != "" && sameName.VsmUUID != d.Id() {
+			return false, fmt.Errorf("Rule with same name already exists in this security policy")
+		}
+
+		// Keep the identity of the action so NSX updates it in place.
+		newAction.ObjectID = existingAction.ObjectID
+		newAction.ObjectTypeName = existingAction.ObjectTypeName
+		newAction.VsmUUID = existingAction.VsmUUID
+		newAction.NodeID = existingAction.NodeID
+		newAction.Revision = existingAction.Revision
+		newAction.TypeName = existingAction.TypeName
+		newAction.Description = existingAction.Description
+		*existingAction = *newAction
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error updating security policy rule: %v", err)
+	}
+
+	return resourceSecurityPolicyRuleRead(d, m)
+}
+
 func resourceSecurityPolicyRuleDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var name string
 	var securityPolicyName string
 
@@ -218,26 +383,26 @@ func resourceSecurityPolicyRuleDelete(d *schema.ResourceData, m interface{}) err
 
 	log.Print("Getting policy object to modify")
 	policyToModify, err := getSingleSecurityPolicy(securityPolicyName, nsxclient)
-	log.Printf("[DEBUG] - policyTOModify :%s", policyToModify)
-
 	if err != nil {
 		return err
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] policyToModify.Remove(%s)", name))
-	// FIXME:  RemoveFirewallActionByName probably return a error for consistency
-	policyToModify.RemoveFirewallActionByName(name)
-	log.Printf("[DEBUG] - policyTOModify :%s", policyToModify)
-	updateAPI := securitypolicy.NewUpdate(policyToModify.ObjectID, policyToModify)
-
-	err = nsxclient.Do(updateAPI)
-
-	if err != nil {
-		return fmt.Errorf("Error creating security group: %v", err)
+	// If the policy is gone, so is the rule.
+	if policyToModify.ObjectID == "" {
+		d.SetId("")
+		return nil
 	}
 
-	if updateAPI.StatusCode() != 200 {
-		return fmt.Errorf("%s", updateAPI.ResponseObject())
+	err = modifySecurityPolicy(policyToModify.ObjectID, nsxclient, func(securityPolicy *SecurityPolicy) (bool, error) {
+		if securityPolicy.GetActionByUUID(d.Id()).VsmUUID == "" {
+			return false, nil
+		}
+		log.Printf(fmt.Sprintf("[DEBUG] securityPolicy.RemoveActionByUUID(%s)", d.Id()))
+		securityPolicy.RemoveActionByUUID(d.Id())
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error deleting security policy rule: %v", err)
 	}
 
 	err = waitForRuleDeleted(securityPolicyName, name, 3, nsxclient)
@@ -258,7 +423,7 @@ func resourceSecurityPolicyRuleDelete(d *schema.ResourceData, m interface{}) err
 // will fail to delete for a short amount of time (~1 second) after the deletion of the rule.
 // By reading back the security policy and confirming the rule has been removed this does not happen anymore and
 // is preferable to a sleep(1 second)
-func waitForRuleDeleted(securityPolicyName string, name string, iterations int, nsxclient *gonsx.NSXClient) error {
+func waitForRuleDeleted(securityPolicyName string, name string, iterations int, nsxclient *NSXClient) error {
 
 	if iterations == 0 {
 		return nil
@@ -272,7 +437,7 @@ func waitForRuleDeleted(securityPolicyName string, name string, iterations int,
 			return err
 		}
 
-		existingAction := policyToRead.GetFirewallRuleByName(name)
+		existingAction := policyToRead.GetActionByName(name)
 		id := existingAction.VsmUUID
 
 		if id == "" {
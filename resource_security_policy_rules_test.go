@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/hashicorp/terraform/helper/schema"
+	"testing"
+)
+
+func TestBuildSecurityPolicyAction(t *testing.T) {
+	testCases := []struct {
+		name        string
+		raw         map[string]interface{}
+		expectError bool
+		check       func(*Action) bool
+	}{
+		{
+			name: "firewall",
+			raw: map[string]interface{}{
+				"name": "web", "securitypolicyname": "p", "action": "allow", "direction": "inbound",
+				"serviceids": []interface{}{"application-1"},
+			},
+			check: func(a *Action) bool {
+				return a.Class == "firewallSecurityAction" && a.Action == "allow" && len(a.Applications.Applications) == 1
+			},
+		},
+		{
+			name: "firewall without action",
+			raw: map[string]interface{}{
+				"name": "web", "securitypolicyname": "p", "direction": "inbound", "serviceids": []interface{}{"any"},
+			},
+			expectError: true,
+		},
+		{
+			name: "endpoint",
+			raw: map[string]interface{}{
+				"name": "av", "securitypolicyname": "p", "category": "endpoint", "service_id": "service-1",
+			},
+			check: func(a *Action) bool {
+				return a.Class == "endpointSecurityAction" && a.ServiceID == "service-1" && a.ServiceProfile == nil && a.Redirect == nil
+			},
+		},
+		{
+			name: "endpoint without service",
+			raw: map[string]interface{}{
+				"name": "av", "securitypolicyname": "p", "category": "endpoint",
+			},
+			expectError: true,
+		},
+		{
+			name: "traffic steering",
+			raw: map[string]interface{}{
+				"name": "ids", "securitypolicyname": "p", "category": "traffic_steering",
+				"service_profile_id": "serviceprofile-1", "serviceids": []interface{}{"any"},
+			},
+			check: func(a *Action) bool {
+				return a.Class == "trafficSteeringSecurityAction" && *a.Redirect && a.ServiceProfile.ObjectID == "serviceprofile-1" && a.Applications == nil
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		d := schema.TestResourceDataRaw(t, resourceSecurityPolicyRule().Schema, tc.raw)
+		action, err := buildSecurityPolicyAction(d)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+			continue
+		}
+		if !tc.check(action) {
+			t.Errorf("%s: unexpected action %#v", tc.name, action)
+		}
+	}
+}
+
+func TestSecurityPolicyKeepsActionCategories(t *testing.T) {
+	input := `<securityPolicy><objectId>policy-1</objectId><name>p</name><precedence>5000</precedence>
+<parent><objectId>policy-2</objectId></parent>
+<actionsByCategory><category>endpoint</category><action class="endpointSecurityAction"><name>av</name><category>endpoint</category><isEnabled>true</isEnabled><serviceId>service-1</serviceId></action></actionsByCategory>
+<actionsByCategory><category>firewall</category><action class="firewallSecurityAction"><name>web</name><category>firewall</category><isEnabled>true</isEnabled><action>allow</action><direction>inbound</direction></action></actionsByCategory>
+</securityPolicy>`
+
+	var securityPolicy SecurityPolicy
+	if err := xml.Unmarshal([]byte(input), &securityPolicy); err != nil {
+		t.Fatal(err)
+	}
+	securityPolicy.RemoveActionByName("web")
+	redirect := true
+	securityPolicy.AddAction(Action{Name: "ids", Category: securityPolicyCategoryTrafficSteering, Redirect: &redirect})
+
+	if securityPolicy.Parent == nil || securityPolicy.Parent.ObjectID != "policy-2" {
+		t.Fatalf("expected parent policy-2, got %#v", securityPolicy.Parent)
+	}
+	if len(securityPolicy.ActionsByCategory) != 3 {
+		t.Fatalf("expected 3 categories, got %d", len(securityPolicy.ActionsByCategory))
+	}
+	if securityPolicy.GetActionByName("av").ServiceID != "service-1" {
+		t.Fatalf("endpoint action was lost")
+	}
+	if securityPolicy.GetActionByName("web").Name != "" {
+		t.Fatalf("firewall action was not removed")
+	}
+	if securityPolicy.GetActionByName("ids").Class != "trafficSteeringSecurityAction" {
+		t.Fatalf("traffic steering action has the wrong class")
+	}
+}
+
+func TestResourceSecurityPolicyRuleRead(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/policy/securitypolicy/all", `<securityPolicies><securityPolicy><objectId>policy-1</objectId><name>p</name><precedence>5000</precedence>
+<actionsByCategory><category>firewall</category><action class="firewallSecurityAction"><vsmUuid>uuid-1</vsmUuid><name>web</name><category>firewall</category><isEnabled>true</isEnabled><action>block</action><direction>outbound</direction>
+<secondarySecurityGroup><objectId>securitygroup-2</objectId></secondarySecurityGroup><applications><application><objectId>application-9</objectId></application></applications></action></actionsByCategory>
+</securityPolicy></securityPolicies>`)
+	nsxclient := server.client()
+
+	// A rule created by an older version of the provider, with its name as ID.
+	d := schema.TestResourceDataRaw(t, resourceSecurityPolicyRule().Schema, map[string]interface{}{
+		"name": "web", "securitypolicyname": "p", "action": "allow", "direction": "inbound",
+		"serviceids": []interface{}{"application-1"},
+	})
+	d.SetId("web")
+
+	if err := resourceSecurityPolicyRuleRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "uuid-1" {
+		t.Fatalf("expected ID uuid-1, got %s", d.Id())
+	}
+	if d.Get("action") != "block" || d.Get("direction") != "outbound" {
+		t.Fatalf("expected block/outbound, got %s/%s", d.Get("action"), d.Get("direction"))
+	}
+	if groups := d.Get("securitygroupids").([]interface{}); len(groups) != 1 || groups[0] != "securitygroup-2" {
+		t.Fatalf("unexpected securitygroupids %v", groups)
+	}
+	if services := d.Get("serviceids").([]interface{}); len(services) != 1 || services[0] != "application-9" {
+		t.Fatalf("unexpected serviceids %v", services)
+	}
+
+	d.SetId("uuid-2")
+	if err := resourceSecurityPolicyRuleRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected the missing rule to be removed from state, got ID %s", d.Id())
+	}
+}
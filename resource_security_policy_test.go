@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestModifySecurityPolicyRetriesOnConflict(t *testing.T) {
+	defer func(backoff time.Duration) { securityPolicyRetryBackoff = backoff }(securityPolicyRetryBackoff)
+	securityPolicyRetryBackoff = 0
+
+	revision := 7
+	puts := 0
+
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/policy/securitypolicy/policy-1", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, "<securityPolicy><objectId>policy-1</objectId><revision>%d</revision><name>p</name><precedence>5000</precedence></securityPolicy>", revision)
+	})
+	server.handle(http.MethodPut, "/api/2.0/services/policy/securitypolicy/policy-1", func(w http.ResponseWriter, r *http.Request) {
+		puts++
+		body, _ := ioutil.ReadAll(r.Body)
+		var securityPolicy SecurityPolicy
+		if err := xml.Unmarshal(body, &securityPolicy); err != nil {
+			t.Errorf("invalid request body: %s", err)
+		}
+		// Simulate somebody else updating the policy before our first write.
+		if puts == 1 {
+			revision++
+		}
+		if securityPolicy.Revision != revision {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		revision++
+	})
+	nsxclient := server.client()
+
+	err := modifySecurityPolicy("policy-1", nsxclient, func(securityPolicy *SecurityPolicy) (bool, error) {
+		securityPolicy.Description = "changed"
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts != 2 {
+		t.Fatalf("expected 2 updates, got %d", puts)
+	}
+	if revision != 9 {
+		t.Fatalf("expected revision 9, got %d", revision)
+	}
+}
+
+func TestResourceSecurityPolicyCreateKeepsPrecedenceUnique(t *testing.T) {
+	var securityPolicies []SecurityPolicy
+
+	server := newTestNSXServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/policy/securitypolicy/all", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		body, _ := xml.Marshal(SecurityPolicies{SecurityPolicies: securityPolicies})
+		w.Write(body)
+	})
+	server.handle(http.MethodPost, "/api/2.0/services/policy/securitypolicy", func(w http.ResponseWriter, r *http.Request) {
+		var securityPolicy SecurityPolicy
+		body, _ := ioutil.ReadAll(r.Body)
+		xml.Unmarshal(body, &securityPolicy)
+		securityPolicy.ObjectID = fmt.Sprintf("policy-%d", len(securityPolicies)+1)
+		securityPolicies = append(securityPolicies, securityPolicy)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, securityPolicy.ObjectID)
+	})
+	nsxclient := server.client()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for _, name := range []string{"web", "db"} {
+		d := schema.TestResourceDataRaw(t, resourceSecurityPolicy().Schema, map[string]interface{}{"name": name, "precedence": 5000})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- resourceSecurityPolicyCreate(d, nsxclient)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	failed := 0
+	for err := range errs {
+		if err != nil {
+			if !strings.Contains(err.Error(), "precedence 5000 is already used") {
+				t.Errorf("unexpected error %v", err)
+			}
+			failed++
+		}
+	}
+	if failed != 1 || len(securityPolicies) != 1 {
+		t.Fatalf("expected exactly one policy with precedence 5000, got %d policies and %d errors", len(securityPolicies), failed)
+	}
+}
@@ -4,21 +4,20 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/securitytag"
 	"log"
 )
 
-func getSingleSecurityTag(name string, nsxclient *gonsx.NSXClient) (*securitytag.SecurityTag, error) {
-	getAllAPI := securitytag.NewGetAll()
+func getSingleSecurityTag(name string, universal bool, nsxclient *NSXClient) (*SecurityTag, error) {
+	getAllAPI := NewGetAllSecurityTags(universal)
 	err := nsxclient.Do(getAllAPI)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if getAllAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAPI.StatusCode(), getAllAPI.ResponseObject())
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
 	}
 
 	securityTag := getAllAPI.GetResponse().FilterByName(name)
@@ -48,12 +47,13 @@ func resourceSecurityTag() *schema.Resource {
 				Required: true,
 				ForceNew: false,
 			},
+			"universal": schemaUniversal(),
 		},
 	}
 }
 
 func resourceSecurityTagCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var name, desc string //, singleoperation string
 
 	// Gather the attributes for the resource.
@@ -69,8 +69,9 @@ func resourceSecurityTagCreate(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("desc argument is required")
 	}
 
-	log.Printf(fmt.Sprintf("[DEBUG] securitytag.NewCreate(%s, %s)", name, desc))
-	createAPI := securitytag.NewCreate(name, desc)
+	securityTag := SecurityTag{Name: name, Description: desc, IsUniversal: d.Get("universal").(bool)}
+	log.Printf(fmt.Sprintf("[DEBUG] NewCreateSecurityTag(%+v)", securityTag))
+	createAPI := NewCreateSecurityTag(&securityTag)
 	err := nsxclient.Do(createAPI)
 
 	if err != nil {
@@ -78,9 +79,8 @@ func resourceSecurityTagCreate(d *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
-	if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("Failed to create security tag %s. StatusCode: %d, Response:%s",
-			name, createAPI.StatusCode(), createAPI.GetResponse())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	// If we get to here creation was successful. Set the ID for the Terraform state file
@@ -96,7 +96,7 @@ func resourceSecurityTagCreate(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceSecurityTagRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var name string
 
 	// Gather the attributes for the resource.
@@ -108,36 +108,36 @@ func resourceSecurityTagRead(d *schema.ResourceData, m interface{}) error {
 
 	// Gather all the resources that are associated with the specified
 	// edgeid.
-	log.Printf(fmt.Sprintf("[DEBUG] securitytag.NewGetAll()"))
-	api := securitytag.NewGetAll()
+	log.Printf(fmt.Sprintf("[DEBUG] NewGetAllSecurityTags()"))
+	api := NewGetAllSecurityTags(d.Get("universal").(bool))
 	err := nsxclient.Do(api)
 
 	if err != nil {
 		return err
 	}
 
-	// See if we can find our specifically named resource within the list of
-	// resources associated with the edgeid.
-	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	securityTagObject, err := getSingleSecurityTag(name, nsxclient)
-
-	if err != nil {
+	if err := checkerr(api); err != nil {
 		return err
 	}
 
-	id := securityTagObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
+	// See if we can find our specifically named resource within the list of
+	// resources associated with the edgeid.
+	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
+	securityTag := api.GetResponse().FilterByName(name)
+	log.Printf(fmt.Sprintf("[DEBUG] id := %s", securityTag.ObjectID))
 
 	// If the resource has been removed manually, notify Terraform of this fact.
-	if id == "" {
+	if securityTag.ObjectID == "" {
 		d.SetId("")
+		return nil
 	}
 
+	d.Set("universal", securityTag.IsUniversal)
 	return nil
 }
 
 func resourceSecurityTagDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var name string //, singleoperation string
 
 	// Gather the attributes for the resource.
@@ -149,26 +149,30 @@ func resourceSecurityTagDelete(d *schema.ResourceData, m interface{}) error {
 
 	// Gather all the resources that are associated with the specified
 	// edgeid.
-	log.Printf(fmt.Sprintf("[DEBUG] securitytag.NewGetAll()"))
-	api := securitytag.NewGetAll()
+	log.Printf(fmt.Sprintf("[DEBUG] NewGetAllSecurityTags()"))
+	api := NewGetAllSecurityTags(d.Get("universal").(bool))
 	err := nsxclient.Do(api)
 
 	if err != nil {
 		return err
 	}
 
+	if err := checkerr(api); err != nil {
+		return err
+	}
+
 	// See if we can find our specifically named resource within the list of
 	// resources associated with the edgeid.
 	log.Printf(fmt.Sprintf("[DEBUG] api.GetResponse().FilterByName(\"%s\").ObjectID", name))
-	securityTagObject, err := getSingleSecurityTag(name, nsxclient)
+	id := api.GetResponse().FilterByName(name).ObjectID
+	log.Printf(fmt.Sprintf("[DEBUG] security tag id := %s", id))
 
-	if err != nil {
-		return err
+	// If the resource has been removed manually, notify Terraform of this fact.
+	if id == "" {
+		d.SetId("")
+		return nil
 	}
 
-	id := securityTagObject.ObjectID
-	log.Printf(fmt.Sprintf("[DEBUG] security tag id := %s", id))
-
 	// If we got here, the resource exists, so we attempt to delete it.
 	deleteAPI := securitytag.NewDelete(id)
 	err = nsxclient.Do(deleteAPI)
@@ -177,9 +181,8 @@ func resourceSecurityTagDelete(d *schema.ResourceData, m interface{}) error {
 		return err
 	}
 
-	if deleteAPI.StatusCode() != 200 {
-		//log.Printf(fmt.Sprintf("[DEBUG] id %s deleted.", id))
-		return fmt.Errorf("[DEBUG] response object: %s", deleteAPI.ResponseObject())
+	if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
 	}
 
 	// If we got here, the resource had existed, we deleted it and there was
@@ -191,13 +194,13 @@ func resourceSecurityTagDelete(d *schema.ResourceData, m interface{}) error {
 }
 
 func resourceSecurityTagUpdate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	hasChanges := false
 	oldName, newName := d.GetChange("name")
 
-	securityTagObject, err := getSingleSecurityTag(oldName.(string), nsxclient)
+	securityTagObject, err := getSingleSecurityTag(oldName.(string), d.Get("universal").(bool), nsxclient)
 	if err != nil {
-		log.Printf(fmt.Sprintf("[DEBUG] Error getting the security tag : %s", err))
+		return err
 	}
 
 	if d.HasChange("name") {
@@ -214,11 +217,15 @@ func resourceSecurityTagUpdate(d *schema.ResourceData, m interface{}) error {
 	}
 
 	if hasChanges {
-		securityTagObject.Revision += securityTagObject.Revision
-		updateAPI := securitytag.NewUpdate(securityTagObject.ObjectID, securityTagObject)
+		// NSX rejects the update if the revision we read is no longer current.
+		log.Printf(fmt.Sprintf("[DEBUG] Updating security tag %s at revision %d", securityTagObject.ObjectID, securityTagObject.Revision))
+		updateAPI := NewUpdateSecurityTag(securityTagObject.ObjectID, securityTagObject)
 		err := nsxclient.Do(updateAPI)
 		if err != nil {
-			log.Printf(fmt.Sprintf("[DEBUG] Error updating security tag: %s", err))
+			return fmt.Errorf("Error updating security tag %s: %v", securityTagObject.ObjectID, err)
+		}
+		if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 		return resourceSecurityTagRead(d, m)
 	}
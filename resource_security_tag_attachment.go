@@ -4,24 +4,38 @@ import (
 	"errors"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/securitytag"
 	"log"
+	"strings"
 )
 
-func getAllSecurityTagsAttached(moid string, nsxclient *gonsx.NSXClient) (*securitytag.SecurityTags, error) {
+func getAllSecurityTagsAttached(moid string, nsxclient *NSXClient) (*securitytag.SecurityTags, error) {
 	getAllAttachedToVMAPI := securitytag.NewGetAllAttachedToVM(moid)
 	err := nsxclient.Do(getAllAttachedToVMAPI)
 	if err != nil {
 		return nil, err
 	}
-	if getAllAttachedToVMAPI.StatusCode() != 200 {
-		return nil, fmt.Errorf("Status code: %d, Response: %s", getAllAttachedToVMAPI.StatusCode(), getAllAttachedToVMAPI.ResponseObject())
+	if err := checkerr(getAllAttachedToVMAPI); err != nil {
+		return nil, err
 	}
 	securityTagsAttached := getAllAttachedToVMAPI.GetResponse()
 	return securityTagsAttached, err
 }
 
+// getSecurityTagVMs returns the VMs the security tag is attached to. If the
+// security tag does not exist the error satisfies isNotFoundError.
+func getSecurityTagVMs(securityTagID string, nsxclient *NSXClient) ([]securitytag.BasicInfo, error) {
+	getAllAttachedAPI := securitytag.NewGetAllAttached(securityTagID)
+	err := nsxclient.Do(getAllAttachedAPI)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkerr(getAllAttachedAPI); err != nil {
+		return nil, err
+	}
+	return getAllAttachedAPI.GetResponse().BasicInfoList, nil
+}
+
 func getAttachmentList(tagIDs []string) *securitytag.AttachmentList {
 	securityTags := new(securitytag.AttachmentList)
 	for _, value := range tagIDs {
@@ -39,11 +53,12 @@ func resourceSecurityTagAttachment() *schema.Resource {
 		Delete: resourceSecurityTagAttachmentDelete,
 		Update: resourceSecurityTagAttachmentUpdate,
 
-		Schema: map[string]*schema.Schema{
+		Schema: schemaVirtualMachineSelectors(map[string]*schema.Schema{
 			"name": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
+				Type:       schema.TypeString,
+				Optional:   true,
+				ForceNew:   true,
+				Deprecated: "name is no longer part of the ID and is ignored",
 			},
 			"tagid": {
 				Type:     schema.TypeList,
@@ -51,18 +66,18 @@ func resourceSecurityTagAttachment() *schema.Resource {
 				ForceNew: false,
 				Elem:     &schema.Schema{Type: schema.TypeString},
 			},
-			"moid": {
-				Type:     schema.TypeString,
-				Required: true,
-				ForceNew: true,
-			},
-		},
+		}),
 	}
 }
 
+// securityTagAttachmentMOID returns the VM MOID from the resource ID, which
+// used to be name/moid.
+func securityTagAttachmentMOID(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
 func resourceSecurityTagAttachmentCreate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name, moid string
+	nsxclient := nsxClientFor(d, m)
 	var tagIDs []string
 
 	if v, ok := d.GetOk("tagid"); ok {
@@ -79,17 +94,11 @@ func resourceSecurityTagAttachmentCreate(d *schema.ResourceData, m interface{})
 		return fmt.Errorf("tagid argument is required")
 	}
 
-	if v, ok := d.GetOk("moid"); ok {
-		moid = v.(string)
-	} else {
-		return fmt.Errorf("moid argument is required")
-	}
-
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return fmt.Errorf("name argument is required")
+	moid, err := resolveVirtualMachineID(d, nsxclient)
+	if err != nil {
+		return err
 	}
+	d.Set("moid", moid)
 
 	securityTags := getAttachmentList(tagIDs)
 	createAPI := securitytag.NewUpdateAttachedTags(moid, securityTags)
@@ -99,16 +108,14 @@ func resourceSecurityTagAttachmentCreate(d *schema.ResourceData, m interface{})
 		return createErr
 	}
 
-	if createAPI.StatusCode() != 200 {
-		log.Printf(fmt.Sprintf("[DEBUG] Response %v", createAPI.ResponseObject()))
-		return fmt.Errorf("Failed to attach security tag %s", tagIDs)
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
-	id := name + "/" + moid
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
+	log.Printf(fmt.Sprintf("[DEBUG] id := %s", moid))
 
 	if len(tagIDs) > 0 && moid != "" {
-		d.SetId(id)
+		d.SetId(moid)
 	} else {
 		return errors.New("Can not establish the id of the created resource")
 	}
@@ -117,52 +124,66 @@ func resourceSecurityTagAttachmentCreate(d *schema.ResourceData, m interface{})
 }
 
 func resourceSecurityTagAttachmentRead(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name, moid string
-	var tagList []interface{}
-	var tagIDs []string
+	nsxclient := nsxClientFor(d, m)
 
-	if v, ok := d.GetOk("tagid"); ok {
-		tagList = v.([]interface{})
-		tagIDs = make([]string, len(tagList))
-		for i, value := range tagList {
-			tagID, ok := value.(string)
-			if !ok {
-				return fmt.Errorf("empty element found in securitytags")
-			}
-			tagIDs[i] = tagID
-		}
-	} else {
-		return fmt.Errorf("tagid argument is required")
+	// Older versions stored name/moid as the ID, name was always empty on
+	// read. The MOID alone is stable.
+	moid := securityTagAttachmentMOID(d.Id())
+	if moid == "" {
+		return errors.New("Can not establish the id of the resource")
 	}
 
-	if v, ok := d.GetOk("moid"); ok {
-		moid = v.(string)
-		d.Set("moid", moid)
-	} else {
-		return fmt.Errorf("moid argument is required")
-	}
-
-	_, err := getAllSecurityTagsAttached(moid, nsxclient)
+	attachedTags, err := getAllSecurityTagsAttached(moid, nsxclient)
 
 	if err != nil {
+		// The VM has been removed, and its tags with it.
+		if isNotFoundError(err) {
+			log.Printf(fmt.Sprintf("[DEBUG] VM %s not found, state will be cleared", moid))
+			d.SetId("")
+			return nil
+		}
 		return err
 	}
 
-	id := name + "/" + moid
-	log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
+	// The tags actually attached make up tagid, so that tags detached
+	// manually are attached again and tags attached outside Terraform show
+	// up in the plan. Those already in state keep their order.
+	attached := make(map[string]bool)
+	for _, securityTag := range attachedTags.SecurityTags {
+		attached[securityTag.ObjectID] = true
+	}
+	var tagIDs []string
+	for _, value := range d.Get("tagid").([]interface{}) {
+		tagID, _ := value.(string)
+		if attached[tagID] {
+			tagIDs = append(tagIDs, tagID)
+			delete(attached, tagID)
+		}
+	}
+	for _, securityTag := range attachedTags.SecurityTags {
+		if attached[securityTag.ObjectID] {
+			tagIDs = append(tagIDs, securityTag.ObjectID)
+			delete(attached, securityTag.ObjectID)
+		}
+	}
 
-	if len(tagIDs) > 0 && moid != "" {
-		d.SetId(id)
-	} else {
-		return errors.New("Can not establish the id of the created resource")
+	// If the resource has been removed manually, notify Terraform of this fact.
+	if len(tagIDs) == 0 {
+		log.Printf(fmt.Sprintf("[DEBUG] No security tag is attached to %s anymore, state will be cleared", moid))
+		d.SetId("")
+		return nil
 	}
 
+	log.Printf(fmt.Sprintf("[DEBUG] id := %s", moid))
+	d.SetId(moid)
+	d.Set("moid", moid)
+	d.Set("tagid", tagIDs)
+
 	return nil
 }
 
 func resourceSecurityTagAttachmentDelete(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, m)
 	var moid string
 	var tagIDs []string
 
@@ -180,11 +201,7 @@ func resourceSecurityTagAttachmentDelete(d *schema.ResourceData, m interface{})
 		return fmt.Errorf("tag argument is required")
 	}
 
-	if v, ok := d.GetOk("moid"); ok {
-		moid = v.(string)
-	} else {
-		return fmt.Errorf("moid argument is required")
-	}
+	moid = securityTagAttachmentMOID(d.Id())
 
 	// See if we can find our specifically named resource within the list of
 	// resources associated with the scopeid.
@@ -222,6 +239,9 @@ func resourceSecurityTagAttachmentDelete(d *schema.ResourceData, m interface{})
 		if err != nil {
 			return err
 		}
+		if err := checkerr(detachAPI); err != nil && !isNotFoundError(err) {
+			return err
+		}
 	}
 
 	// If we got here, the resource had existed, we deleted it and there was
@@ -233,21 +253,9 @@ func resourceSecurityTagAttachmentDelete(d *schema.ResourceData, m interface{})
 }
 
 func resourceSecurityTagAttachmentUpdate(d *schema.ResourceData, m interface{}) error {
-	nsxclient := m.(*gonsx.NSXClient)
-	var name, moid string
+	nsxclient := nsxClientFor(d, m)
 	var tagIDs []string
-
-	if v, ok := d.GetOk("moid"); ok {
-		moid = v.(string)
-	} else {
-		return fmt.Errorf("moid argument is required")
-	}
-
-	if v, ok := d.GetOk("name"); ok {
-		name = v.(string)
-	} else {
-		return fmt.Errorf("name argument is required")
-	}
+	moid := securityTagAttachmentMOID(d.Id())
 
 	if d.HasChange("tagid") {
 
@@ -289,26 +297,23 @@ func resourceSecurityTagAttachmentUpdate(d *schema.ResourceData, m interface{})
 			if err != nil {
 				return err
 			}
+			if err := checkerr(detachAPI); err != nil && !isNotFoundError(err) {
+				return err
+			}
 		}
 
 		updateAPI := securitytag.NewUpdateAttachedTags(moid, securityTags)
 		updateErr := nsxclient.Do(updateAPI)
 
 		if updateErr != nil {
-			return err
+			return updateErr
 		}
 
-		if updateAPI.StatusCode() != 200 {
-			log.Printf(fmt.Sprintf("[DEBUG] Response %v", updateAPI.ResponseObject()))
-			return fmt.Errorf("Failed to attach security tags")
+		if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 
-		id := name + "/" + moid
-		log.Printf(fmt.Sprintf("[DEBUG] id := %s", id))
-
-		if len(tagIDs) > 0 && moid != "" {
-			d.SetId(id)
-		} else {
+		if len(tagIDs) == 0 || moid == "" {
 			return errors.New("Can not establish the id of the updated resource")
 		}
 		return resourceSecurityTagAttachmentRead(d, m)
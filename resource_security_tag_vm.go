@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/sky-uk/gonsx/api/securitytag"
+	"log"
+	"strings"
+)
+
+// resourceSecurityTagVM attaches a single security tag to a single VM. Unlike
+// nsx_security_tag_attachment it leaves the other tags of the VM alone.
+func resourceSecurityTagVM() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceSecurityTagVMCreate,
+		Read:   resourceSecurityTagVMRead,
+		Delete: resourceSecurityTagVMDelete,
+		Importer: &schema.ResourceImporter{
+			State: schema.ImportStatePassthrough,
+		},
+
+		Schema: schemaVirtualMachineSelectors(map[string]*schema.Schema{
+			"security_tag_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+		}),
+	}
+}
+
+func resourceSecurityTagVMCreate(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityTagID := d.Get("security_tag_id").(string)
+
+	moid, err := resolveVirtualMachineID(d, nsxclient)
+	if err != nil {
+		return err
+	}
+
+	log.Printf(fmt.Sprintf("[DEBUG] securitytag.NewAssign(%s, %s)", securityTagID, moid))
+	assignAPI := securitytag.NewAssign(securityTagID, moid)
+	err = nsxclient.Do(assignAPI)
+
+	if err != nil {
+		return fmt.Errorf("Error attaching security tag %s to %s: %v", securityTagID, moid, err)
+	}
+
+	if err := checkerr(assignAPI); err != nil {
+		return err
+	}
+
+	d.SetId(securityTagID + ":" + moid)
+	return resourceSecurityTagVMRead(d, m)
+}
+
+func resourceSecurityTagVMRead(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+
+	s := strings.Split(d.Id(), ":")
+	if len(s) != 2 {
+		return fmt.Errorf("Invalid security tag VM ID %s, expected <security tag ID>:<VM MOID>", d.Id())
+	}
+	securityTagID, moid := s[0], s[1]
+
+	virtualMachines, err := getSecurityTagVMs(securityTagID, nsxclient)
+	if isNotFoundError(err) {
+		log.Printf("[DEBUG] Security tag %s no longer exists", securityTagID)
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, vm := range virtualMachines {
+		if vm.ObjectID == moid {
+			// Found
+			d.Set("security_tag_id", securityTagID)
+			d.Set("moid", moid)
+			return nil
+		}
+	}
+
+	// Not found
+	log.Printf("[DEBUG] Security tag %s is no longer attached to %s", securityTagID, moid)
+	d.SetId("")
+	return nil
+}
+
+func resourceSecurityTagVMDelete(d *schema.ResourceData, m interface{}) error {
+	nsxclient := nsxClientFor(d, m)
+	securityTagID := d.Get("security_tag_id").(string)
+	moid := d.Get("moid").(string)
+
+	log.Printf(fmt.Sprintf("[DEBUG] securitytag.NewDetach(%s, %s)", securityTagID, moid))
+	detachAPI := securitytag.NewDetach(securityTagID, moid)
+	err := nsxclient.Do(detachAPI)
+
+	if err != nil {
+		return fmt.Errorf("Error detaching security tag %s from %s: %v", securityTagID, moid, err)
+	}
+
+	// The security tag, the VM or the attachment is already gone.
+	if err := checkerr(detachAPI); err != nil && !isNotFoundError(err) {
+		return err
+	}
+
+	d.SetId("")
+	return nil
+}
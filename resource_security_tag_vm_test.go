@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"testing"
+)
+
+func TestResourceSecurityTagVM(t *testing.T) {
+	attached := map[string]bool{"vm-2": true}
+
+	server := newTestVirtualMachineServer()
+	defer server.Close()
+	server.handle(http.MethodGet, "/api/2.0/services/securitytags/tag/securitytag-1/vm", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, "<basicinfolist>")
+		for moid := range attached {
+			fmt.Fprintf(w, "<basicinfo><objectId>%s</objectId></basicinfo>", moid)
+		}
+		fmt.Fprint(w, "</basicinfolist>")
+	})
+	server.handle(http.MethodPut, "/api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1", func(w http.ResponseWriter, r *http.Request) {
+		attached["vm-1"] = true
+	})
+	server.handle(http.MethodDelete, "/api/2.0/services/securitytags/tag/securitytag-1/vm/vm-1", func(w http.ResponseWriter, r *http.Request) {
+		delete(attached, "vm-1")
+	})
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityTagVM().Schema, map[string]interface{}{
+		"security_tag_id": "securitytag-1",
+		"vm_name":         "web-01",
+	})
+
+	if err := resourceSecurityTagVMCreate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "securitytag-1:vm-1" || d.Get("moid").(string) != "vm-1" {
+		t.Fatalf("unexpected ID %s and moid %s", d.Id(), d.Get("moid"))
+	}
+
+	if err := resourceSecurityTagVMDelete(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if !attached["vm-2"] || attached["vm-1"] {
+		t.Fatalf("unexpected attachments after delete: %v", attached)
+	}
+
+	d.SetId("securitytag-1:vm-1")
+	if err := resourceSecurityTagVMRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected the detached VM to be dropped from state, got ID %s", d.Id())
+	}
+
+	d.SetId("securitytag-9:vm-1")
+	if err := resourceSecurityTagVMRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "" {
+		t.Fatalf("expected a deleted security tag to be dropped from state, got ID %s", d.Id())
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		if server.requested(method, "/api/2.0/services/securitytags/vm/vm-1") != 0 {
+			t.Errorf("unexpected %s of all the tags of the VM", method)
+		}
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"encoding/xml"
 	"fmt"
 	"github.com/hashicorp/terraform/helper/schema"
-	"github.com/sky-uk/gonsx"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/sky-uk/gonsx/api/service"
 	"log"
+	"regexp"
 	"strings"
 )
 
@@ -28,10 +29,13 @@ func resourceService() *schema.Resource {
 
 			"scopeid": {
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
 			},
 
+			"universal": schemaUniversal(),
+
 			"description": {
 				Type:     schema.TypeString,
 				Required: false,
@@ -39,20 +43,187 @@ func resourceService() *schema.Resource {
 			},
 
 			"protocol": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"element"},
+				Description:   "Protocol of a service with a single element, use element for more",
 			},
 
 			"ports": {
-				Type:     schema.TypeString,
-				Required: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"element"},
+				Description:   "Ports of a service with a single element, use element for more",
+			},
+
+			"element": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"protocol": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringMatch(regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`), "protocol must be an NSX protocol name such as TCP, UDP, ICMP, FTP or MS_RPC_TCP"),
+						},
+						"ports": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateServicePorts,
+						},
+						"source_ports": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validateServicePorts,
+						},
+						"icmp_type": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							ValidateFunc: validation.StringInSlice(serviceICMPTypes, false),
+						},
+					},
+				},
 			},
 		},
 	}
 }
 
-func getService(nsxclient *gonsx.NSXClient, applicationID string) (*service.ApplicationService, error) {
-	api := service.NewGet(applicationID)
+// servicePortProtocols are the protocols, including the application level
+// gateways, whose elements take destination and source ports.
+var servicePortProtocols = []string{
+	"TCP", "UDP",
+	"FTP", "TFTP", "ORACLE_TNS",
+	"MS_RPC_TCP", "MS_RPC_UDP", "SUN_RPC_TCP", "SUN_RPC_UDP",
+	"NBNS_BROADCAST", "NBDG_BROADCAST",
+}
+
+// serviceICMPProtocols are the protocols whose elements take an ICMP type.
+var serviceICMPProtocols = []string{"ICMP", "IPV6ICMP"}
+
+var serviceICMPTypes = []string{
+	"echo-reply", "destination-unreachable", "source-quench", "redirect",
+	"echo-request", "router-advertisement", "router-solicitation", "time-exceeded",
+	"parameter-problem", "timestamp-request", "timestamp-reply",
+	"address-mask-request", "address-mask-reply",
+}
+
+func stringInList(value string, list []string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateServicePorts checks a comma separated list of ports and port ranges.
+func validateServicePorts(v interface{}, k string) (warns []string, errs []error) {
+	value := v.(string)
+	if value == "" {
+		return
+	}
+	for _, port := range strings.Split(value, ",") {
+		port = strings.TrimSpace(port)
+		if port == "any" {
+			errs = append(errs, fmt.Errorf("%q: ports must list ports (e.g. 80) or port ranges (e.g. 8000-8080), got: %s", k, value))
+			return
+		}
+		if _, portErrs := validateNSXPortOrAny()(port, k); len(portErrs) != 0 {
+			errs = append(errs, fmt.Errorf("%q: ports must list ports (e.g. 80) or port ranges (e.g. 8000-8080), got: %s", k, value))
+			return
+		}
+	}
+	return
+}
+
+// buildServiceElement checks that the fields of an element match its protocol.
+func buildServiceElement(protocol, ports, sourcePorts, icmpType string) (ApplicationElement, error) {
+	element := ApplicationElement{ApplicationProtocol: protocol}
+
+	switch {
+	case stringInList(protocol, servicePortProtocols):
+		if icmpType != "" {
+			return element, fmt.Errorf("icmp_type is not supported by protocol %s", protocol)
+		}
+		if (protocol == "TCP" || protocol == "UDP") && ports == "" {
+			return element, fmt.Errorf("ports are required for protocol %s", protocol)
+		}
+		for _, value := range []string{ports, sourcePorts} {
+			if _, errs := validateServicePorts(value, "ports"); len(errs) != 0 {
+				return element, errs[0]
+			}
+		}
+		element.Value = ports
+		element.SourcePort = sourcePorts
+
+	case stringInList(protocol, serviceICMPProtocols):
+		if ports != "" || sourcePorts != "" {
+			return element, fmt.Errorf("ports are not supported by protocol %s, use icmp_type", protocol)
+		}
+		element.Value = icmpType
+
+	default:
+		if ports != "" || sourcePorts != "" || icmpType != "" {
+			return element, fmt.Errorf("protocol %s takes neither ports nor icmp_type", protocol)
+		}
+	}
+
+	return element, nil
+}
+
+func expandServiceElements(list []interface{}) ([]ApplicationElement, error) {
+	elements := []ApplicationElement{}
+	for _, raw := range list {
+		e := raw.(map[string]interface{})
+		element, err := buildServiceElement(e["protocol"].(string), e["ports"].(string), e["source_ports"].(string), e["icmp_type"].(string))
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// buildSingleServiceElement returns the element given by the protocol and
+// ports arguments. This form predates icmp_type and keeps the ICMP type in ports.
+func buildSingleServiceElement(d *schema.ResourceData) ([]ApplicationElement, error) {
+	protocol := d.Get("protocol").(string)
+	if protocol == "" {
+		return nil, fmt.Errorf("one of protocol or element is required")
+	}
+	element := ApplicationElement{ApplicationProtocol: protocol, Value: d.Get("ports").(string)}
+	if stringInList(protocol, servicePortProtocols) {
+		if _, errs := validateServicePorts(element.Value, "ports"); len(errs) != 0 {
+			return nil, errs[0]
+		}
+	}
+	return []ApplicationElement{element}, nil
+}
+
+func flattenServiceElements(elements []ApplicationElement) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(elements))
+	for _, element := range elements {
+		e := map[string]interface{}{
+			"protocol":     element.ApplicationProtocol,
+			"ports":        "",
+			"source_ports": element.SourcePort,
+			"icmp_type":    "",
+		}
+		if stringInList(element.ApplicationProtocol, serviceICMPProtocols) {
+			e["icmp_type"] = element.Value
+		} else {
+			e["ports"] = element.Value
+		}
+		list = append(list, e)
+	}
+	return list
+}
+
+func getService(nsxclient *NSXClient, applicationID string) (*ApplicationService, error) {
+	api := NewGetService(applicationID)
 	err := nsxclient.Do(api)
 
 	// API Error
@@ -60,22 +231,18 @@ func getService(nsxclient *gonsx.NSXClient, applicationID string) (*service.Appl
 		return nil, fmt.Errorf("Could not fetch ApplicationService: %s: %s", applicationID, err)
 	}
 
-	// Found
-	if api.StatusCode() == 200 {
-		service := api.GetResponse()
-		return service, nil
-	}
-
-	// Does not exist
-	if api.StatusCode() == 404 {
-		return nil, nil
+	if err := checkerr(api); err != nil {
+		// Does not exist
+		if isNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
 
-	// Unknown Status Codes => Error
-	return nil, fmt.Errorf("Could not fetch ApplicationService: %s: Status code: %d, Response: %s", applicationID, api.StatusCode(), api.ResponseObject())
+	return api.GetResponse(), nil
 }
 
-func printService(rule *service.ApplicationService) {
+func printService(rule *ApplicationService) {
 	rule_xml, err := xml.MarshalIndent(rule, "", "  ")
 	if err != nil {
 		log.Printf("Error: %v", err)
@@ -84,36 +251,56 @@ func printService(rule *service.ApplicationService) {
 }
 
 func resourceServiceCreate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
-	var name, scopeid, description, protocol, ports string
+	nsxclient := nsxClientFor(d, meta)
+	var name, description string
+	var elements []ApplicationElement
+
+	scopeid, err := resolveScopeID(d)
+	if err != nil {
+		return err
+	}
 
 	// Gather the attributes for the resource.
 	name = d.Get("name").(string)
-	scopeid = d.Get("scopeid").(string)
 	description = d.Get("description").(string)
-	protocol = d.Get("protocol").(string)
-	ports = d.Get("ports").(string)
+	if v, ok := d.GetOk("element"); ok {
+		elements, err = expandServiceElements(v.([]interface{}))
+	} else {
+		elements, err = buildSingleServiceElement(d)
+	}
+	if err != nil {
+		return err
+	}
 
 	// Create the API, use it and check for errors.
-	createAPI := service.NewCreate(scopeid, name, description, protocol, ports)
-	err := nsxclient.Do(createAPI)
+	createAPI := NewCreateService(scopeid, &ApplicationService{
+		Name:        name,
+		Description: description,
+		IsUniversal: d.Get("universal").(bool),
+		Element:     elements,
+	})
+	err = nsxclient.Do(createAPI)
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
 	}
 
-	if createAPI.StatusCode() != 201 {
-		return fmt.Errorf("%s", createAPI.ResponseObject())
+	if err := checkerr(createAPI); err != nil {
+		return err
 	}
 
 	id := createAPI.GetResponse()
 	d.SetId(id)
+	d.Set("scopeid", scopeid)
 
 	return resourceServiceRead(d, meta)
 }
 
 func resourceServiceImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
-	service_id := strings.Split(d.Id(), "_")
+	service_id := strings.SplitN(d.Id(), "_", 2)
+	if len(service_id) != 2 {
+		return nil, fmt.Errorf("Invalid service import ID %s, expected <scope ID>_<service ID>", d.Id())
+	}
 	d.Set("scopeid", service_id[0])
 	d.SetId(service_id[1])
 	err := resourceServiceRead(d, meta)
@@ -124,7 +311,7 @@ func resourceServiceImport(d *schema.ResourceData, meta interface{}) ([]*schema.
 }
 
 func resourceServiceRead(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var id = d.Id()
 
 	log.Printf(fmt.Sprintf("[DEBUG] ServiceID %s", id))
@@ -142,8 +329,12 @@ func resourceServiceRead(d *schema.ResourceData, meta interface{}) error {
 
 	d.Set("name", service.Name)
 	d.Set("description", service.Description)
+	d.Set("universal", service.IsUniversal)
+
+	d.Set("element", flattenServiceElements(service.Element))
 
-	if len(service.Element) != 0 {
+	// protocol and ports only describe services with a single element.
+	if len(service.Element) == 1 {
 		d.Set("protocol", service.Element[0].ApplicationProtocol)
 		d.Set("ports", service.Element[0].Value)
 	} else {
@@ -155,7 +346,7 @@ func resourceServiceRead(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceServiceDelete(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var id = d.Id()
 
 	deleteAPI := service.NewDelete(id)
@@ -165,8 +356,8 @@ func resourceServiceDelete(d *schema.ResourceData, meta interface{}) error {
 
 	if err != nil {
 		return fmt.Errorf("Error: %v", err)
-	} else if deleteAPI.StatusCode() != 200 {
-		return fmt.Errorf("Failed to delete %s", id)
+	} else if err := checkerr(deleteAPI); err != nil && !isNotFoundError(err) {
+		return err
 	}
 
 	d.SetId("")
@@ -174,7 +365,7 @@ func resourceServiceDelete(d *schema.ResourceData, meta interface{}) error {
 }
 
 func resourceServiceUpdate(d *schema.ResourceData, meta interface{}) error {
-	nsxclient := meta.(*gonsx.NSXClient)
+	nsxclient := nsxClientFor(d, meta)
 	var id = d.Id()
 	hasChanges := false
 
@@ -204,27 +395,38 @@ func resourceServiceUpdate(d *schema.ResourceData, meta interface{}) error {
 		serviceObject.Description = newDesc.(string)
 	}
 
-	if d.HasChange("protocol") || d.HasChange("ports") {
+	if d.HasChange("element") {
+		hasChanges = true
+		elements, err := expandServiceElements(d.Get("element").([]interface{}))
+		if err != nil {
+			return err
+		}
+		serviceObject.Element = elements
+		log.Printf(fmt.Sprintf("[DEBUG] Changing elements of service to %v", elements))
+	} else if d.HasChange("protocol") || d.HasChange("ports") {
 		hasChanges = true
 		oldProtocol, newProtocol := d.GetChange("protocol")
 		oldPorts, newPorts := d.GetChange("ports")
-		newElement := service.Element{ApplicationProtocol: newProtocol.(string), Value: newPorts.(string)}
-		serviceObject.Element = []service.Element{newElement}
+		elements, err := buildSingleServiceElement(d)
+		if err != nil {
+			return err
+		}
+		serviceObject.Element = elements
 		log.Printf(fmt.Sprintf("[DEBUG] Changing protocol and/or ports of service from %s:%s to %s:%s",
 			oldProtocol.(string), oldPorts.(string), newProtocol.(string), newPorts.(string)))
 	}
 
 	if hasChanges {
 		serviceObject.Revision = serviceObject.Revision + 1
-		updateAPI := service.NewUpdate(id, serviceObject)
+		updateAPI := NewUpdateService(id, serviceObject)
 		log.Printf(updateAPI.Endpoint())
 		err = nsxclient.Do(updateAPI)
 
 		if err != nil {
 			log.Printf(fmt.Sprintf("[DEBUG] Error updating service resource: %s", err))
 			return err
-		} else if updateAPI.StatusCode() != 200 {
-			return fmt.Errorf("Failed to update ServiceApplication: %d, %s", updateAPI.StatusCode(), updateAPI.GetResponse())
+		} else if err := checkerr(updateAPI); err != nil {
+			return err
 		}
 	}
 	return resourceServiceRead(d, meta)
@@ -3,8 +3,8 @@ package main
 import (
 	"fmt"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
-	"github.com/sky-uk/gonsx"
 	"github.com/sky-uk/gonsx/api/service"
 	"strings"
 	"testing"
@@ -63,7 +63,7 @@ func TestAccService(t *testing.T) {
 
 func testAccServiceWithPrefixDontExist(scopeid string, prefix string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		api := service.NewGetAll(scopeid)
 		err := nsxClient.Do(api)
@@ -85,7 +85,7 @@ func testAccServiceWithPrefixDontExist(scopeid string, prefix string) resource.T
 
 func testAccServiceWithNameExists(scopeid string, name string) resource.TestCheckFunc {
 	return func(state *terraform.State) error {
-		nsxClient := testAccProvider.Meta().(*gonsx.NSXClient)
+		nsxClient := testAccProvider.Meta().(*NSXClient)
 
 		api := service.NewGetAll(scopeid)
 		err := nsxClient.Do(api)
@@ -104,3 +104,110 @@ func testAccServiceWithNameExists(scopeid string, name string) resource.TestChec
 		return fmt.Errorf("Service with name %s wasn't found", name)
 	}
 }
+
+func TestAccServiceElements(t *testing.T) {
+	scopeID := loadServiceScopeId(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccServiceWithPrefixDontExist(scopeID, "tf_testing"),
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(`   resource "nsx_service" "ftp" {
+										    name = "tf_testing_service_ftp"
+										    scopeid = "%s"
+										    element {
+										        protocol = "FTP"
+										        ports = "21"
+										        source_ports = "1024-65535"
+										    }
+										}`, scopeID),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("nsx_service.ftp", "element.#", "1"),
+					resource.TestCheckResourceAttr("nsx_service.ftp", "element.0.source_ports", "1024-65535"),
+					resource.TestCheckResourceAttr("nsx_service.ftp", "protocol", "FTP"),
+					testAccServiceWithNameExists(scopeID, "tf_testing_service_ftp"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(`   resource "nsx_service" "ftp" {
+										    name = "tf_testing_service_ftp"
+										    scopeid = "%s"
+										    element {
+										        protocol = "ICMP"
+										        icmp_type = "echo-request"
+										    }
+										}`, scopeID),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("nsx_service.ftp", "element.0.icmp_type", "echo-request"),
+					resource.TestCheckResourceAttr("nsx_service.ftp", "element.0.ports", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestValidateServicePorts(t *testing.T) {
+	for _, value := range []string{"", "80", "80,443", "8000-8080", "22, 8000-8080"} {
+		if _, errs := validateServicePorts(value, "ports"); len(errs) != 0 {
+			t.Errorf("expected %q to be valid, got %v", value, errs)
+		}
+	}
+	for _, value := range []string{"any", "http", "80;443", "1-2-3", "70000", "80,"} {
+		if _, errs := validateServicePorts(value, "ports"); len(errs) == 0 {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestBuildServiceElement(t *testing.T) {
+	testCases := []struct {
+		protocol, ports, sourcePorts, icmpType string
+		expected                               ApplicationElement
+		expectError                            bool
+	}{
+		{protocol: "TCP", ports: "443", sourcePorts: "1024-65535", expected: ApplicationElement{ApplicationProtocol: "TCP", Value: "443", SourcePort: "1024-65535"}},
+		{protocol: "MS_RPC_TCP", ports: "135", expected: ApplicationElement{ApplicationProtocol: "MS_RPC_TCP", Value: "135"}},
+		{protocol: "NBNS_BROADCAST", expected: ApplicationElement{ApplicationProtocol: "NBNS_BROADCAST"}},
+		{protocol: "ICMP", icmpType: "echo-request", expected: ApplicationElement{ApplicationProtocol: "ICMP", Value: "echo-request"}},
+		{protocol: "TCP", expectError: true},
+		{protocol: "TCP", ports: "80", icmpType: "echo-request", expectError: true},
+		{protocol: "ICMP", ports: "80", expectError: true},
+		{protocol: "GRE", ports: "80", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		element, err := buildServiceElement(tc.protocol, tc.ports, tc.sourcePorts, tc.icmpType)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.protocol)
+			}
+			continue
+		}
+		if err != nil || element != tc.expected {
+			t.Errorf("%s: expected %#v, got %#v (%v)", tc.protocol, tc.expected, element, err)
+		}
+	}
+}
+
+func TestResourceServiceImport(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/application/application-1", "<application><objectId>application-1</objectId><name>web_https</name></application>")
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceService().Schema, map[string]interface{}{})
+	d.SetId("globalroot-0_application-1")
+	if _, err := resourceServiceImport(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "application-1" || d.Get("scopeid").(string) != "globalroot-0" {
+		t.Fatalf("expected application-1 in globalroot-0, got %s in %s", d.Id(), d.Get("scopeid"))
+	}
+
+	d.SetId("application-1")
+	if _, err := resourceServiceImport(d, nsxclient); err == nil || !strings.Contains(err.Error(), "Invalid service import ID") {
+		t.Fatalf("expected an import ID without scope to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// securityPolicyPrecedenceStep is the gap left to the sibling policy when a
+// policy is placed at either end of the precedence order.
+const securityPolicyPrecedenceStep = 1000
+
+// securityPolicyPrecedenceMutexKey serializes picking a precedence with
+// writing it, as NSX does not refuse two policies with the same precedence.
+const securityPolicyPrecedenceMutexKey = "security_policy_precedence"
+
+// resourceSecurityPolicyMigrateState moves states written while precedence
+// was a string to the integer attribute. Values which are not a positive
+// integer are dropped and read again from NSX on the next refresh.
+func resourceSecurityPolicyMigrateState(v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if is == nil || is.Empty() || v > 0 {
+		return is, nil
+	}
+
+	if value, ok := is.Attributes["precedence"]; ok {
+		precedence, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || precedence <= 0 {
+			log.Printf("[DEBUG] Dropping invalid precedence %q of security policy %s from state", value, is.ID)
+			delete(is.Attributes, "precedence")
+		} else {
+			is.Attributes["precedence"] = strconv.Itoa(precedence)
+		}
+	}
+	return is, nil
+}
+
+// schemaSecurityPolicyList describes security policies listed as neighbors of
+// a policy or by the nsx_security_policies data source.
+func schemaSecurityPolicyList() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Computed: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"id": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"name": {
+					Type:     schema.TypeString,
+					Computed: true,
+				},
+				"precedence": {
+					Type:     schema.TypeInt,
+					Computed: true,
+				},
+			},
+		},
+	}
+}
+
+func flattenSecurityPolicyList(securityPolicies []SecurityPolicy) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(securityPolicies))
+	for _, securityPolicy := range securityPolicies {
+		precedence, _ := strconv.Atoi(securityPolicy.Precedence)
+		list = append(list, map[string]interface{}{
+			"id":         securityPolicy.ObjectID,
+			"name":       securityPolicy.Name,
+			"precedence": precedence,
+		})
+	}
+	return list
+}
+
+// sortSecurityPoliciesByPrecedence returns the policies in the order NSX
+// applies them, highest precedence first.
+func sortSecurityPoliciesByPrecedence(securityPolicies []SecurityPolicy) []SecurityPolicy {
+	sorted := make([]SecurityPolicy, len(securityPolicies))
+	copy(sorted, securityPolicies)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		left, _ := strconv.Atoi(sorted[i].Precedence)
+		right, _ := strconv.Atoi(sorted[j].Precedence)
+		return left > right
+	})
+	return sorted
+}
+
+// securityPolicyNeighbors returns the policies directly above and below the
+// policy with the given ID in precedence order.
+func securityPolicyNeighbors(securityPolicies []SecurityPolicy, id string) []SecurityPolicy {
+	sorted := sortSecurityPoliciesByPrecedence(securityPolicies)
+	neighbors := []SecurityPolicy{}
+	for idx, securityPolicy := range sorted {
+		if securityPolicy.ObjectID != id {
+			continue
+		}
+		if idx > 0 {
+			neighbors = append(neighbors, sorted[idx-1])
+		}
+		if idx < len(sorted)-1 {
+			neighbors = append(neighbors, sorted[idx+1])
+		}
+	}
+	return neighbors
+}
+
+// checkSecurityPolicyPrecedenceFree returns an error naming the policy that
+// already uses the precedence, other than the policy with the given ID.
+func checkSecurityPolicyPrecedenceFree(securityPolicies []SecurityPolicy, id, precedence string) error {
+	wanted, _ := strconv.Atoi(precedence)
+	for _, securityPolicy := range securityPolicies {
+		current, _ := strconv.Atoi(securityPolicy.Precedence)
+		if securityPolicy.ObjectID != id && current == wanted {
+			return fmt.Errorf("precedence %d is already used by security policy %s (%s)", wanted, securityPolicy.Name, securityPolicy.ObjectID)
+		}
+	}
+	return nil
+}
+
+// securityPolicyPlacement reads the sibling and direction of auto_precedence.
+// before places the policy directly above the sibling, after directly below.
+func securityPolicyPlacement(d *schema.ResourceData) (sibling string, before bool, ok bool) {
+	list := d.Get("auto_precedence").([]interface{})
+	if len(list) == 0 || list[0] == nil {
+		return "", false, false
+	}
+	placement := list[0].(map[string]interface{})
+	if v := placement["before"].(string); v != "" {
+		return v, true, true
+	}
+	return placement["after"].(string), false, true
+}
+
+// checkSecurityPolicyPlacement reports whether the policy with the given ID
+// is still on the requested side of its sibling.
+func checkSecurityPolicyPlacement(securityPolicies []SecurityPolicy, id, sibling string, before bool) bool {
+	var self, other *SecurityPolicy
+	for idx := range securityPolicies {
+		if securityPolicies[idx].ObjectID == id {
+			self = &securityPolicies[idx]
+		} else if securityPolicies[idx].Name == sibling {
+			other = &securityPolicies[idx]
+		}
+	}
+	if self == nil || other == nil {
+		return false
+	}
+	selfPrecedence, _ := strconv.Atoi(self.Precedence)
+	otherPrecedence, _ := strconv.Atoi(other.Precedence)
+	if before {
+		return selfPrecedence > otherPrecedence
+	}
+	return selfPrecedence < otherPrecedence
+}
+
+// autoSecurityPolicyPrecedence picks a free precedence directly before or
+// after the sibling, halfway to the next policy. The policy with the given
+// ID is ignored so that an existing policy can be moved.
+func autoSecurityPolicyPrecedence(securityPolicies []SecurityPolicy, id, sibling string, before bool) (string, error) {
+	others := []SecurityPolicy{}
+	for _, securityPolicy := range securityPolicies {
+		if securityPolicy.ObjectID != id {
+			others = append(others, securityPolicy)
+		}
+	}
+	sorted := sortSecurityPoliciesByPrecedence(others)
+
+	siblingIdx := -1
+	for idx, securityPolicy := range sorted {
+		if securityPolicy.Name == sibling {
+			siblingIdx = idx
+			break
+		}
+	}
+	if siblingIdx == -1 {
+		return "", fmt.Errorf("sibling security policy %s not found", sibling)
+	}
+	siblingPrecedence, _ := strconv.Atoi(sorted[siblingIdx].Precedence)
+
+	var precedence, bound int
+	if before {
+		if siblingIdx == 0 {
+			return strconv.Itoa(siblingPrecedence + securityPolicyPrecedenceStep), nil
+		}
+		bound, _ = strconv.Atoi(sorted[siblingIdx-1].Precedence)
+		precedence = siblingPrecedence + (bound-siblingPrecedence)/2
+	} else {
+		if siblingIdx == len(sorted)-1 && siblingPrecedence > securityPolicyPrecedenceStep {
+			return strconv.Itoa(siblingPrecedence - securityPolicyPrecedenceStep), nil
+		}
+		if siblingIdx < len(sorted)-1 {
+			bound, _ = strconv.Atoi(sorted[siblingIdx+1].Precedence)
+		}
+		precedence = bound + (siblingPrecedence-bound)/2
+	}
+
+	if precedence == siblingPrecedence || precedence == bound || precedence <= 0 {
+		return "", fmt.Errorf("no free precedence next to security policy %s (%d), renumber the surrounding policies", sibling, siblingPrecedence)
+	}
+	return strconv.Itoa(precedence), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/terraform"
+	"testing"
+)
+
+func testSecurityPolicies() []SecurityPolicy {
+	return []SecurityPolicy{
+		{ObjectID: "policy-1", Name: "baseline", Precedence: "1000"},
+		{ObjectID: "policy-2", Name: "quarantine", Precedence: "9000"},
+		{ObjectID: "policy-3", Name: "web", Precedence: "5000"},
+		{ObjectID: "policy-4", Name: "db", Precedence: "5001"},
+	}
+}
+
+func TestResourceSecurityPolicyMigrateState(t *testing.T) {
+	testCases := map[string]string{
+		"5000":   "5000",
+		" 0100 ": "100",
+		"high":   "",
+		"-1":     "",
+	}
+
+	for value, expected := range testCases {
+		is := &terraform.InstanceState{ID: "policy-1", Attributes: map[string]string{"name": "web", "precedence": value}}
+		is, err := resourceSecurityPolicyMigrateState(0, is, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := is.Attributes["precedence"]; actual != expected {
+			t.Errorf("%q: expected precedence %q, got %q", value, expected, actual)
+		}
+		if is.Attributes["name"] != "web" {
+			t.Errorf("%q: expected the other attributes to be kept, got %v", value, is.Attributes)
+		}
+	}
+}
+
+func TestSortSecurityPoliciesByPrecedence(t *testing.T) {
+	sorted := sortSecurityPoliciesByPrecedence(testSecurityPolicies())
+	expected := []string{"quarantine", "db", "web", "baseline"}
+	for idx, name := range expected {
+		if sorted[idx].Name != name {
+			t.Fatalf("expected %s at position %d, got %s", name, idx, sorted[idx].Name)
+		}
+	}
+
+	neighbors := securityPolicyNeighbors(testSecurityPolicies(), "policy-3")
+	if len(neighbors) != 2 || neighbors[0].Name != "db" || neighbors[1].Name != "baseline" {
+		t.Fatalf("unexpected neighbors %v", neighbors)
+	}
+}
+
+func TestCheckSecurityPolicyPrecedenceFree(t *testing.T) {
+	if err := checkSecurityPolicyPrecedenceFree(testSecurityPolicies(), "", "5000"); err == nil {
+		t.Fatal("expected a collision with web")
+	}
+	if err := checkSecurityPolicyPrecedenceFree(testSecurityPolicies(), "policy-3", "5000"); err != nil {
+		t.Fatalf("a policy must not collide with itself: %s", err)
+	}
+	if err := checkSecurityPolicyPrecedenceFree(testSecurityPolicies(), "", "4000"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutoSecurityPolicyPrecedence(t *testing.T) {
+	testCases := []struct {
+		id          string
+		sibling     string
+		before      bool
+		expected    string
+		expectError bool
+	}{
+		{sibling: "quarantine", before: true, expected: "10000"},
+		{sibling: "quarantine", before: false, expected: "7000"},
+		{sibling: "web", before: false, expected: "3000"},
+		{sibling: "baseline", before: false, expected: "500"},
+		{sibling: "web", before: true, expectError: true},
+		{id: "policy-4", sibling: "web", before: true, expected: "7000"},
+		{sibling: "missing", before: true, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		precedence, err := autoSecurityPolicyPrecedence(testSecurityPolicies(), tc.id, tc.sibling, tc.before)
+		if tc.expectError {
+			if err == nil {
+				t.Errorf("%s/%v: expected an error, got %s", tc.sibling, tc.before, precedence)
+			}
+			continue
+		}
+		if err != nil || precedence != tc.expected {
+			t.Errorf("%s/%v: expected %s, got %s (%v)", tc.sibling, tc.before, tc.expected, precedence, err)
+		}
+	}
+}
+
+func TestCheckSecurityPolicyPlacement(t *testing.T) {
+	if !checkSecurityPolicyPlacement(testSecurityPolicies(), "policy-4", "web", true) {
+		t.Fatal("db should be before web")
+	}
+	if checkSecurityPolicyPlacement(testSecurityPolicies(), "policy-4", "web", false) {
+		t.Fatal("db should not be after web")
+	}
+	if checkSecurityPolicyPlacement(testSecurityPolicies(), "policy-4", "missing", true) {
+		t.Fatal("placement relative to a missing sibling cannot hold")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+	"sort"
+	"strings"
+)
+
+const (
+	// universalScopeID is the scope of grouping objects which the primary
+	// NSX Manager replicates to every manager in a cross-vCenter deployment.
+	universalScopeID = "universalroot-0"
+	// universalTransportZonePrefix prefixes the ID of universal transport zones.
+	universalTransportZonePrefix = "universalvdnscope"
+	// universalLogicalSwitchPrefix prefixes the ID of universal logical switches.
+	universalLogicalSwitchPrefix = "universalwire-"
+)
+
+func schemaUniversal() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		ForceNew:    true,
+		Description: "Whether the object is universal, i.e. replicated across a cross-vCenter NSX deployment",
+	}
+}
+
+// resolveScopeID returns the scope to create a grouping object in. Universal
+// objects always live in universalroot-0, everything else needs an explicit
+// scopeid.
+func resolveScopeID(d *schema.ResourceData) (string, error) {
+	scopeid := d.Get("scopeid").(string)
+
+	if d.Get("universal").(bool) {
+		if scopeid != "" && scopeid != universalScopeID {
+			return "", fmt.Errorf("scopeid must be %s or unset for universal objects, got %s", universalScopeID, scopeid)
+		}
+		return universalScopeID, nil
+	}
+
+	if scopeid == "" {
+		return "", fmt.Errorf("scopeid argument is required")
+	}
+	if scopeid == universalScopeID {
+		return "", fmt.Errorf("set universal = true to create objects in %s", universalScopeID)
+	}
+	return scopeid, nil
+}
+
+// getUniversalObjectIDs returns the IDs of all universal grouping objects and
+// security tags known to the NSX Manager.
+func getUniversalObjectIDs(nsxclient *NSXClient) (map[string]bool, error) {
+	universalObjectIDs := make(map[string]bool)
+
+	for _, objectType := range []string{"ipset", "macset", "securitygroup", "application", "applicationgroup"} {
+		getAllAPI := NewGetAllGroupingObjects(objectType, universalScopeID)
+		err := nsxclient.Do(getAllAPI)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkerr(getAllAPI); err != nil {
+			return nil, err
+		}
+		for _, object := range getAllAPI.GetResponse().Objects {
+			universalObjectIDs[object.ObjectID] = true
+		}
+	}
+
+	getAllTagsAPI := NewGetAllSecurityTags(true)
+	err := nsxclient.Do(getAllTagsAPI)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkerr(getAllTagsAPI); err != nil {
+		return nil, err
+	}
+	for _, securityTag := range getAllTagsAPI.GetResponse().SecurityTags {
+		universalObjectIDs[securityTag.ObjectID] = true
+	}
+
+	return universalObjectIDs, nil
+}
+
+// validateUniversalReferences makes sure a universal object only references
+// other universal objects, as NSX would otherwise reject it or, worse, fail
+// to replicate it to the secondary managers.
+func validateUniversalReferences(ids []string, nsxclient *NSXClient) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	universalObjectIDs, err := getUniversalObjectIDs(nsxclient)
+	if err != nil {
+		return err
+	}
+
+	var localIDs []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, universalLogicalSwitchPrefix) || universalObjectIDs[id] {
+			continue
+		}
+		localIDs = append(localIDs, id)
+	}
+
+	if len(localIDs) > 0 {
+		sort.Strings(localIDs)
+		log.Printf(fmt.Sprintf("[DEBUG] Non universal references: %v", localIDs))
+		return fmt.Errorf("universal objects can only reference universal objects, these are not universal: %s", strings.Join(localIDs, ", "))
+	}
+	return nil
+}
+
+// isUniversalObject returns whether d describes a universal object, using
+// whichever of universal and scopeid its schema has.
+func isUniversalObject(d *schema.ResourceData) bool {
+	if v, ok := d.GetOk("universal"); ok && v.(bool) {
+		return true
+	}
+	if v, ok := d.GetOk("scopeid"); ok {
+		if scopeid, ok := v.(string); ok && (scopeid == universalScopeID || strings.HasPrefix(scopeid, universalTransportZonePrefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsxClientFor returns the client managing the object of d. Universal objects
+// can only be changed on the primary NSX Manager, local objects go to
+// local_nsxserver when it is set.
+func nsxClientFor(d *schema.ResourceData, m interface{}) *NSXClient {
+	nsxclient := m.(*NSXClient)
+	if nsxclient.local == nil || isUniversalObject(d) {
+		return nsxclient
+	}
+	return nsxclient.local
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"testing"
+)
+
+func TestResolveScopeID(t *testing.T) {
+	cases := []struct {
+		raw      map[string]interface{}
+		expected string
+		err      bool
+	}{
+		{map[string]interface{}{"scopeid": "globalroot-0"}, "globalroot-0", false},
+		{map[string]interface{}{"universal": true}, universalScopeID, false},
+		{map[string]interface{}{"universal": true, "scopeid": universalScopeID}, universalScopeID, false},
+		{map[string]interface{}{"universal": true, "scopeid": "globalroot-0"}, "", true},
+		{map[string]interface{}{"scopeid": universalScopeID}, "", true},
+		{map[string]interface{}{}, "", true},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, resourceIPSet().Schema, c.raw)
+		scopeID, err := resolveScopeID(d)
+		if c.err != (err != nil) {
+			t.Fatalf("%v: unexpected error: %v", c.raw, err)
+		}
+		if scopeID != c.expected {
+			t.Fatalf("%v: expected scope %q, got %q", c.raw, c.expected, scopeID)
+		}
+	}
+}
+
+func TestResourceReadUniversal(t *testing.T) {
+	server := newTestNSXServer()
+	defer server.Close()
+	server.respond("/api/2.0/services/application/application-1", "<application><objectId>application-1</objectId><name>web</name><isUniversal>true</isUniversal></application>")
+	server.respond("/api/2.0/services/securitytags/tag", "<securityTags><securityTag><objectId>securitytag-1</objectId><name>web</name><isUniversal>true</isUniversal></securityTag></securityTags>")
+	server.respond("/api/4.0/firewall/globalroot-0/config", `<firewallConfiguration><layer3Sections>
+<section id="1002" name="local"></section><section id="1003" name="universal" managedBy="universalroot-0"></section>
+</layer3Sections></firewallConfiguration>`)
+	server.respond("/api/4.0/firewall/globalroot-0/config/layer3sections/1003/rules/1001", `<rule id="1001"><name>web</name><action>allow</action><appliedToList><appliedTo><value>DISTRIBUTED_FIREWALL</value><type>DISTRIBUTED_FIREWALL</type></appliedTo></appliedToList><sectionId>1003</sectionId></rule>`)
+	nsxclient := server.client()
+
+	testCases := []struct {
+		read  func(*schema.ResourceData, interface{}) error
+		data  *schema.ResourceData
+		id    string
+		label string
+	}{
+		{resourceServiceRead, schema.TestResourceDataRaw(t, resourceService().Schema, map[string]interface{}{"name": "web"}), "application-1", "service"},
+		{resourceSecurityTagRead, schema.TestResourceDataRaw(t, resourceSecurityTag().Schema, map[string]interface{}{"name": "web", "desc": "Web"}), "securitytag-1", "security tag"},
+		{resourceFirewallRuleRead, schema.TestResourceDataRaw(t, resourceFirewallRule().Schema, map[string]interface{}{"sectionid": 1003}), "1001", "firewall rule"},
+	}
+
+	for _, testCase := range testCases {
+		testCase.data.SetId(testCase.id)
+		if err := testCase.read(testCase.data, nsxclient); err != nil {
+			t.Fatalf("%s: %v", testCase.label, err)
+		}
+		if !testCase.data.Get("universal").(bool) {
+			t.Errorf("%s: expected universal to be read back", testCase.label)
+		}
+	}
+
+	if requests := server.requested(http.MethodGet, "/api/4.0/firewall/globalroot-0/config/layer3sections/1003"); requests != 0 {
+		t.Errorf("expected the section to come from the firewall configuration, got %d requests for it", requests)
+	}
+}
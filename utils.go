@@ -17,9 +17,23 @@ func getListOfStructs(v interface{}) []map[string]interface{} {
 	return vvv
 }
 
+func getListOfStrings(d *schema.ResourceData, key string) ([]string, error) {
+	list := d.Get(key).([]interface{})
+	values := make([]string, len(list))
+	for i, value := range list {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("empty element found in %s", key)
+		}
+		values[i] = str
+	}
+	return values, nil
+}
+
+// checkerr returns an *NSXError unless the call succeeded.
 func checkerr(api api.NSXApi) error {
 	if api.StatusCode() >= 200 && api.StatusCode() <= 399 {
 		return nil
 	}
-	return fmt.Errorf(string(api.RawResponse()))
+	return newNSXError(api)
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/terraform/helper/schema"
+	"log"
+	"strings"
+)
+
+// virtualMachineSelectors are the arguments which identify a virtual machine.
+// NSX knows the names and UUIDs of VMs but not their vCenter inventory path,
+// so there is no selector by path.
+var virtualMachineSelectors = []string{"moid", "vm_name", "vm_instance_uuid", "vm_bios_uuid"}
+
+// schemaVirtualMachineSelectors adds moid, vm_name, vm_instance_uuid and
+// vm_bios_uuid to the schema. Exactly one of them has to be set, and moid is
+// computed from the others.
+func schemaVirtualMachineSelectors(s map[string]*schema.Schema) map[string]*schema.Schema {
+	s["moid"] = &schema.Schema{
+		Type:          schema.TypeString,
+		Optional:      true,
+		Computed:      true,
+		ForceNew:      true,
+		ConflictsWith: []string{"vm_name", "vm_instance_uuid", "vm_bios_uuid"},
+	}
+	s["vm_name"] = &schema.Schema{
+		Type:          schema.TypeString,
+		Optional:      true,
+		ForceNew:      true,
+		ConflictsWith: []string{"vm_instance_uuid", "vm_bios_uuid"},
+	}
+	s["vm_instance_uuid"] = &schema.Schema{
+		Type:          schema.TypeString,
+		Optional:      true,
+		ForceNew:      true,
+		ConflictsWith: []string{"vm_bios_uuid"},
+	}
+	s["vm_bios_uuid"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+		ForceNew: true,
+	}
+	return s
+}
+
+func getAllVirtualMachines(nsxclient *NSXClient) ([]VirtualMachine, error) {
+	getAllAPI := NewGetAllVirtualMachines("globalroot-0")
+	err := nsxclient.Do(getAllAPI)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkerr(getAllAPI); err != nil {
+		return nil, err
+	}
+	return getAllAPI.GetResponse().VirtualMachines, nil
+}
+
+// findVirtualMachine returns the single virtual machine for which match is true.
+func findVirtualMachine(virtualMachines []VirtualMachine, description string, match func(VirtualMachine) bool) (*VirtualMachine, error) {
+	var found []VirtualMachine
+	for _, vm := range virtualMachines {
+		if match(vm) {
+			found = append(found, vm)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("No virtual machine found with %s", description)
+	case 1:
+		return &found[0], nil
+	default:
+		ids := make([]string, len(found))
+		for i, vm := range found {
+			ids[i] = vm.ObjectID
+		}
+		return nil, fmt.Errorf("%d virtual machines found with %s: %s", len(found), description, strings.Join(ids, ", "))
+	}
+}
+
+// resolveVirtualMachineID returns the MOID of the virtual machine selected
+// by moid, vm_name, vm_instance_uuid or vm_bios_uuid.
+func resolveVirtualMachineID(d *schema.ResourceData, nsxclient *NSXClient) (string, error) {
+	if v, ok := d.GetOk("moid"); ok {
+		return v.(string), nil
+	}
+
+	var description string
+	var match func(VirtualMachine) bool
+
+	if v, ok := d.GetOk("vm_name"); ok {
+		name := v.(string)
+		description = fmt.Sprintf("name %s", name)
+		match = func(vm VirtualMachine) bool { return vm.Name == name }
+	} else if v, ok := d.GetOk("vm_instance_uuid"); ok {
+		uuid := strings.ToLower(v.(string))
+		description = fmt.Sprintf("instance UUID %s", uuid)
+		match = func(vm VirtualMachine) bool { return strings.ToLower(vm.ExtendedAttribute("instanceUuid")) == uuid }
+	} else if v, ok := d.GetOk("vm_bios_uuid"); ok {
+		uuid := strings.ToLower(v.(string))
+		description = fmt.Sprintf("BIOS UUID %s", uuid)
+		match = func(vm VirtualMachine) bool { return strings.ToLower(vm.ExtendedAttribute("biosUuid")) == uuid }
+	} else {
+		return "", fmt.Errorf("one of %s is required", strings.Join(virtualMachineSelectors, ", "))
+	}
+
+	virtualMachines, err := getAllVirtualMachines(nsxclient)
+	if err != nil {
+		return "", err
+	}
+
+	vm, err := findVirtualMachine(virtualMachines, description, match)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf(fmt.Sprintf("[DEBUG] Virtual machine with %s is %s", description, vm.ObjectID))
+	return vm.ObjectID, nil
+}
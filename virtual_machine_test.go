@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testVirtualMachinesResponse = `<basicinfolist>
+<basicinfo><objectId>vm-1</objectId><name>web-01</name>
+<extendedAttributes><extendedAttribute><name>instanceUuid</name><value>5003A1B2-0000-0000-0000-000000000001</value></extendedAttribute><extendedAttribute><name>biosUuid</name><value>4203C1D2-0000-0000-0000-000000000001</value></extendedAttribute></extendedAttributes>
+</basicinfo>
+<basicinfo><objectId>vm-2</objectId><name>db</name>
+<extendedAttributes><extendedAttribute><name>instanceUuid</name><value>5003a1b2-0000-0000-0000-000000000002</value></extendedAttribute></extendedAttributes>
+</basicinfo>
+<basicinfo><objectId>vm-3</objectId><name>db</name></basicinfo>
+</basicinfolist>`
+
+// newTestVirtualMachineServer is a fake NSX Manager knowing the VMs of
+// testVirtualMachinesResponse.
+func newTestVirtualMachineServer() *testNSXServer {
+	server := newTestNSXServer()
+	server.respond("/api/2.0/services/securitygroup/scope/globalroot-0/members/VirtualMachine", testVirtualMachinesResponse)
+	return server
+}
+
+func TestResolveVirtualMachineID(t *testing.T) {
+	server := newTestVirtualMachineServer()
+	defer server.Close()
+	nsxclient := server.client()
+
+	testCases := []struct {
+		config   map[string]interface{}
+		expected string
+		err      string
+	}{
+		{config: map[string]interface{}{"moid": "vm-42"}, expected: "vm-42"},
+		{config: map[string]interface{}{"vm_name": "web-01"}, expected: "vm-1"},
+		{config: map[string]interface{}{"vm_instance_uuid": "5003a1b2-0000-0000-0000-000000000001"}, expected: "vm-1"},
+		{config: map[string]interface{}{"vm_bios_uuid": "4203c1d2-0000-0000-0000-000000000001"}, expected: "vm-1"},
+		{config: map[string]interface{}{"vm_name": "db"}, err: "2 virtual machines found with name db: vm-2, vm-3"},
+		{config: map[string]interface{}{"vm_bios_uuid": "5003a1b2-0000-0000-0000-000000000002"}, err: "No virtual machine found with BIOS UUID 5003a1b2-0000-0000-0000-000000000002"},
+		{config: map[string]interface{}{}, err: "one of moid, vm_name, vm_instance_uuid, vm_bios_uuid is required"},
+	}
+
+	for _, testCase := range testCases {
+		d := schema.TestResourceDataRaw(t, resourceSecurityTagAttachment().Schema, testCase.config)
+		moid, err := resolveVirtualMachineID(d, nsxclient)
+		if testCase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), testCase.err) {
+				t.Errorf("%v: expected error %q, got %v", testCase.config, testCase.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %s", testCase.config, err)
+		} else if moid != testCase.expected {
+			t.Errorf("%v: expected %s, got %s", testCase.config, testCase.expected, moid)
+		}
+	}
+}
+
+func TestResourceSecurityTagAttachmentID(t *testing.T) {
+	server := newTestVirtualMachineServer()
+	defer server.Close()
+	server.handle(http.MethodPost, "/api/2.0/services/securitytags/vm/vm-1", func(w http.ResponseWriter, r *http.Request) {})
+	server.respond("/api/2.0/services/securitytags/vm/vm-1", "<securityTags><securityTag><objectId>securitytag-1</objectId></securityTag></securityTags>")
+	nsxclient := server.client()
+
+	d := schema.TestResourceDataRaw(t, resourceSecurityTagAttachment().Schema, map[string]interface{}{
+		"vm_name": "web-01",
+		"tagid":   []interface{}{"securitytag-1"},
+	})
+	if err := resourceSecurityTagAttachmentCreate(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if server.requested(http.MethodPost, "/api/2.0/services/securitytags/vm/vm-1") == 0 {
+		t.Fatal("expected the tags to be attached")
+	}
+	if d.Id() != "vm-1" || d.Get("moid").(string) != "vm-1" {
+		t.Fatalf("expected ID and moid vm-1, got %s and %s", d.Id(), d.Get("moid"))
+	}
+
+	d.SetId("/vm-1")
+	if err := resourceSecurityTagAttachmentRead(d, nsxclient); err != nil {
+		t.Fatal(err)
+	}
+	if d.Id() != "vm-1" {
+		t.Fatalf("expected the legacy ID to be migrated to vm-1, got %s", d.Id())
+	}
+}